@@ -1,7 +1,9 @@
 package block
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-unixfsnode/data"
@@ -10,17 +12,30 @@ import (
 	"github.com/ipld/go-ipld-prime/linking"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multicodec"
 
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
 	_ "github.com/ipld/go-ipld-prime/codec/raw"
 )
 
+// DataType values for blocks that aren't UnixFS, to complement the
+// go-unixfsnode/data.Data_* values.
+const (
+	DataType_RawLeaf int64 = -1 // a raw codec block, a UnixFS file leaf
+	DataType_Node    int64 = -2 // a non-UnixFS IPLD node, e.g. dag-cbor or dag-json
+	DataType_Missing int64 = -3 // a linked block that couldn't be loaded
+	DataType_Invalid int64 = -4 // a block that couldn't be loaded or decoded
+)
+
 type Block struct {
-	ls linking.LinkSystem
+	ls   linking.LinkSystem
+	node datamodel.Node // for non-raw blocks
 
 	Cid        cid.Cid
 	IpldPath   datamodel.Path
 	UnixfsPath datamodel.Path
-	DataType   int64 // go-unixfsnode/data.Data_*
+	DataType   int64 // go-unixfsnode/data.Data_*, DataType_RawLeaf or DataType_Node
 	Children   []Child
 	ByteOffset int64
 	ByteSize   int64
@@ -28,6 +43,9 @@ type Block struct {
 	FieldData  []byte  // bitfield data for sharded nodes
 	BlockSizes []int64 // for sharded files
 	ShardIndex string
+	Target     string     // for symlinks
+	Mode       *uint32    // UnixFS mode, permissions and setuid, setgid and sticky bits, if present
+	Mtime      *time.Time // UnixFS modification time, if present
 }
 
 type Child struct {
@@ -42,10 +60,16 @@ type Child struct {
 }
 
 func (c *Child) Block() (Block, error) {
+	return c.BlockContext(context.Background())
+}
+
+// BlockContext is the same as Block, but the context is used when loading the
+// child block.
+func (c *Child) BlockContext(ctx context.Context) (Block, error) {
 	if c.block != nil {
 		return *c.block, nil
 	}
-	block, err := NewBlockWith(c.ls, c.Cid, c.IpldPath, c.UnixfsPath, c.ByteOffset, c.ShardIndex)
+	block, err := NewBlockWithContext(ctx, c.ls, c.Cid, c.IpldPath, c.UnixfsPath, c.ByteOffset, c.ShardIndex)
 	if err != nil {
 		return Block{}, err
 	}
@@ -54,7 +78,13 @@ func (c *Child) Block() (Block, error) {
 }
 
 func NewBlock(ls linking.LinkSystem, c cid.Cid) (Block, error) {
-	return NewBlockWith(ls, c, datamodel.Path{}, datamodel.Path{}, 0, "")
+	return NewBlockContext(context.Background(), ls, c)
+}
+
+// NewBlockContext is the same as NewBlock, but the context is passed to the
+// LinkSystem when loading the block.
+func NewBlockContext(ctx context.Context, ls linking.LinkSystem, c cid.Cid) (Block, error) {
+	return NewBlockWithContext(ctx, ls, c, datamodel.Path{}, datamodel.Path{}, 0, "")
 }
 
 func NewBlockWith(
@@ -65,26 +95,65 @@ func NewBlockWith(
 	byteOffset int64,
 	shardIndex string,
 ) (Block, error) {
+	return NewBlockWithContext(context.Background(), ls, c, ipldPath, unixfsPath, byteOffset, shardIndex)
+}
+
+// NewBlockWithContext is the same as NewBlockWith, but the context is passed to
+// the LinkSystem when loading the block. If the context is already done, its
+// error is returned without attempting the load.
+func NewBlockWithContext(
+	ctx context.Context,
+	ls linking.LinkSystem,
+	c cid.Cid,
+	ipldPath,
+	unixfsPath datamodel.Path,
+	byteOffset int64,
+	shardIndex string,
+) (Block, error) {
+	if err := ctx.Err(); err != nil {
+		return Block{}, err
+	}
 
-	node, err := ls.Load(linking.LinkContext{}, cidlink.Link{Cid: c}, basicnode.Prototype.Any)
+	node, err := ls.Load(linking.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, basicnode.Prototype.Any)
 	if err != nil {
+		if isNotFound(err) {
+			return Block{}, ErrMissingBlock{Cid: c, Path: unixfsPath, Err: err}
+		}
 		return Block{}, err
 	}
 
-	var dt int64 = -1
+	dt := DataType_RawLeaf
 	var byteSize int64
 	var children []Child
 	var fieldData []byte
 	var arity int64
 	var blockSizes []int64
+	var target string
+	var mode *uint32
+	var mtime *time.Time
+	var ipldNode datamodel.Node
 
-	if node.Kind() == datamodel.Kind_Bytes {
+	if c.Prefix().Codec == cid.Raw {
 		byt, err := node.AsBytes()
 		if err != nil {
 			return Block{}, err
 		}
 		byteSize = int64(len(byt))
+	} else if c.Prefix().Codec != cid.DagProtobuf {
+		dt = DataType_Node
+		ipldNode = node
+		if err := forEachLink(node, datamodel.Path{}, func(p datamodel.Path, lnk cid.Cid) {
+			children = append(children, Child{
+				ls:         ls,
+				Cid:        lnk,
+				IpldPath:   ipldPath.Join(p),
+				UnixfsPath: unixfsPath.Join(p),
+			})
+		}); err != nil {
+			return Block{}, err
+		}
 	} else {
+		ipldNode = node
 		pbNode, err := unixfs.ToPbnode(node)
 		if err != nil {
 			return Block{}, err
@@ -94,13 +163,26 @@ func NewBlockWith(
 			return Block{}, err
 		}
 		dt = ufsData.DataType.Int()
+		if ufsData.FieldMode().Exists() {
+			m := uint32(ufsData.FieldMode().Must().Int())
+			mode = &m
+		}
+		if ufsData.FieldMtime().Exists() {
+			ut := ufsData.FieldMtime().Must()
+			var nsecs int64
+			if ut.FieldFractionalNanoseconds().Exists() {
+				nsecs = ut.FieldFractionalNanoseconds().Must().Int()
+			}
+			t := time.Unix(ut.FieldSeconds().Int(), nsecs)
+			mtime = &t
+		}
 
 		switch dt {
 		case data.Data_Raw:
-			if !pbNode.Data.Exists() {
+			if !ufsData.FieldData().Exists() {
 				return Block{}, fmt.Errorf("raw block has no data")
 			}
-			byteSize = int64(len(pbNode.Data.Must().Bytes()))
+			byteSize = int64(len(ufsData.FieldData().Must().Bytes()))
 		case data.Data_Directory:
 			children = make([]Child, pbNode.Links.Length())
 			for itr := pbNode.Links.Iterator(); !itr.Done(); {
@@ -123,20 +205,24 @@ func NewBlockWith(
 				ii, v := li.Next()
 				blockSizes[ii] = v.Int()
 			}
-			var offset int64
+			if len(blockSizes) != len(children) {
+				return Block{}, fmt.Errorf("file has %d links but %d blocksizes", len(children), len(blockSizes))
+			}
+			// any data in this node precedes the content of its children, which
+			// follow each other at the offsets given by blocksizes; this holds at
+			// every level, so a child's offset is relative to this node's
+			if ufsData.FieldData().Exists() {
+				byteSize = int64(len(ufsData.FieldData().Must().Bytes()))
+			}
 			for itr := pbNode.Links.Iterator(); !itr.Done(); {
 				ii, v := itr.Next()
-				if !v.Name.Exists() {
-					return Block{}, fmt.Errorf("directory link has no name")
-				}
 				children[ii] = Child{
 					ls:         ls,
 					Cid:        v.Hash.Link().(cidlink.Link).Cid,
 					IpldPath:   ipldPath.AppendSegmentString("Links").AppendSegmentInt(ii).AppendSegmentString("Hash"),
 					UnixfsPath: unixfsPath,
-					ByteOffset: byteOffset + offset, // TODO: is this correct for nested file structures?
+					ByteOffset: byteOffset + byteSize,
 				}
-				offset += blockSizes[ii]
 				byteSize += blockSizes[ii]
 			}
 		case data.Data_HAMTShard:
@@ -163,10 +249,12 @@ func NewBlockWith(
 					ShardIndex: pfx,
 				}
 			}
-		case data.Data_Metadata:
-			return Block{}, fmt.Errorf("metadata block not supported")
 		case data.Data_Symlink:
-			return Block{}, fmt.Errorf("metadata block not supported")
+			if ufsData.FieldData().Exists() {
+				target = string(ufsData.FieldData().Must().Bytes())
+			}
+		case data.Data_Metadata:
+			return Block{}, ErrUnsupportedDataType{Cid: c, DataType: data.DataTypeNames[dt]}
 		default:
 			return Block{}, fmt.Errorf("unknown data type: %d", ufsData.Type())
 		}
@@ -174,6 +262,7 @@ func NewBlockWith(
 
 	return Block{
 		ls:         ls,
+		node:       ipldNode,
 		Cid:        c,
 		DataType:   dt,
 		IpldPath:   ipldPath,
@@ -185,6 +274,9 @@ func NewBlockWith(
 		FieldData:  fieldData,
 		BlockSizes: blockSizes,
 		ShardIndex: shardIndex,
+		Target:     target,
+		Mode:       mode,
+		Mtime:      mtime,
 	}, nil
 }
 
@@ -192,13 +284,119 @@ func (b Block) DataTypeString() string {
 	if dtn, has := data.DataTypeNames[b.DataType]; has {
 		return dtn
 	}
+	if b.DataType == DataType_Node {
+		return multicodec.Code(b.Cid.Prefix().Codec).String()
+	}
+	if b.DataType == DataType_Missing {
+		return "Missing"
+	}
+	if b.DataType == DataType_Invalid {
+		return "Invalid"
+	}
 	return "RawLeaf"
 }
 
-func (b Block) Length() int64 {
-	var l int64
-	for _, c := range b.BlockSizes {
-		l += c
+// missingChild describes the child at index ii, which couldn't be loaded, as
+// a block of DataType_Missing. For file chunks, the expected size is taken
+// from this block's BlockSizes.
+func (b Block) missingChild(ii int) Block {
+	child := b.Children[ii]
+	var byteSize int64
+	if b.DataType == data.Data_File && ii < len(b.BlockSizes) {
+		byteSize = b.BlockSizes[ii]
 	}
-	return l
+	return Block{
+		ls:         b.ls,
+		Cid:        child.Cid,
+		DataType:   DataType_Missing,
+		IpldPath:   child.IpldPath,
+		UnixfsPath: child.UnixfsPath,
+		ByteOffset: child.ByteOffset,
+		ByteSize:   byteSize,
+		ShardIndex: child.ShardIndex,
+	}
+}
+
+// forEachLink walks a node, calling fn with the path within the node and the
+// CID of each link it finds, in order.
+func forEachLink(node datamodel.Node, p datamodel.Path, fn func(p datamodel.Path, lnk cid.Cid)) error {
+	switch node.Kind() {
+	case datamodel.Kind_Map:
+		for itr := node.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			ks, err := k.AsString()
+			if err != nil {
+				return err
+			}
+			if err := forEachLink(v, p.AppendSegmentString(ks), fn); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_List:
+		for itr := node.ListIterator(); !itr.Done(); {
+			ii, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if err := forEachLink(v, p.AppendSegmentInt(ii), fn); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_Link:
+		lnk, err := node.AsLink()
+		if err != nil {
+			return err
+		}
+		cl, ok := lnk.(cidlink.Link)
+		if !ok {
+			return fmt.Errorf("unexpected link type: %T", lnk)
+		}
+		fn(p, cl.Cid)
+	}
+	return nil
+}
+
+// hasPath checks whether a path, relative to base (this block's UnixfsPath or
+// IpldPath), exists within the node of this block without crossing a link.
+func (b Block) hasPath(base, p datamodel.Path) bool {
+	if b.node == nil {
+		return false
+	}
+	segs := p.Segments()[base.Len():]
+	n := b.node
+	for _, seg := range segs {
+		if n.Kind() == datamodel.Kind_Link {
+			return false
+		}
+		var err error
+		if n, err = n.LookupBySegment(seg); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// childrenUnder returns the children of this block whose UnixfsPath, or
+// IpldPath if ipld is true, is at, or under, the given path.
+func (b Block) childrenUnder(p datamodel.Path, ipld bool) []Child {
+	children := make([]Child, 0)
+	for _, child := range b.Children {
+		cp := child.UnixfsPath
+		if ipld {
+			cp = child.IpldPath
+		}
+		if isPrefix(p, cp) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Length is the number of bytes of file content in this block and the blocks
+// below it; zero for blocks that aren't part of a file.
+func (b Block) Length() int64 {
+	return b.ByteSize
 }
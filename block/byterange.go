@@ -0,0 +1,187 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// ByteRangeResolution describes how a byte range resolves against the file
+// at the terminus of a path.
+type ByteRangeResolution struct {
+	Requested trustlessutils.ByteRange
+	From      int64   // inclusive, after resolving negative offsets
+	To        int64   // inclusive, after resolving negative offsets and clamping to Length
+	Length    int64   // of the file
+	Leaves    []Block // the blocks holding data overlapping the range, in order, including missing ones
+}
+
+// FirstWasted is the number of bytes of the first leaf that precede the
+// range. A leaf here is any block whose own data overlaps the range, which
+// includes intermediate nodes of a file that hold data.
+func (r ByteRangeResolution) FirstWasted() int64 {
+	if len(r.Leaves) == 0 {
+		return 0
+	}
+	return r.From - r.Leaves[0].ByteOffset
+}
+
+// LastWasted is the number of bytes of the last leaf that follow the range.
+func (r ByteRangeResolution) LastWasted() int64 {
+	if len(r.Leaves) == 0 {
+		return 0
+	}
+	last := r.Leaves[len(r.Leaves)-1]
+	return last.ByteOffset + last.dataSize() - 1 - r.To
+}
+
+// Write writes a human readable summary of the resolution.
+func (r ByteRangeResolution) Write(w io.Writer) {
+	switch {
+	case r.From > r.To && r.From >= r.Length:
+		fmt.Fprintf(w, "Byte range %s starts at or beyond the end of the entity of %s B\n", r.Requested.String(), humanize.Comma(r.Length))
+		return
+	case r.From > r.To:
+		// a negative end that reaches back to, or before, the start
+		fmt.Fprintf(w, "Byte range %s is empty, its end resolves to at or before its start of %d in the entity of %s B\n", r.Requested.String(), r.From, humanize.Comma(r.Length))
+		return
+	}
+	fmt.Fprintf(w, "Byte range %s resolves to [%d:%d] of %s B\n", r.Requested.String(), r.From, r.To, humanize.Comma(r.Length))
+	switch len(r.Leaves) {
+	case 0:
+		fmt.Fprintf(w, "  no leaf blocks overlap the range\n")
+		return
+	case 1:
+		fmt.Fprintf(w, "  1 leaf block overlaps, %s\n", leafString(r.Leaves[0]))
+	default:
+		fmt.Fprintf(w, "  %d leaf blocks overlap, from %s to %s\n", len(r.Leaves), leafString(r.Leaves[0]), leafString(r.Leaves[len(r.Leaves)-1]))
+	}
+	fmt.Fprintf(w, "  %s B wasted before the range in the first leaf, %s B after it in the last\n", humanize.Comma(r.FirstWasted()), humanize.Comma(r.LastWasted()))
+}
+
+func leafString(b Block) string {
+	return fmt.Sprintf("%s [%d:%d]", b.Cid, b.ByteOffset, b.ByteOffset+b.dataSize()-1)
+}
+
+// ResolveByteRange navigates to the entity at the terminus of the path and
+// resolves the byte range against it, reporting which blocks hold the bytes in
+// range. An ErrUnsupportedDataType is returned if the entity isn't a file, and
+// an ErrInvalidByteRange if the range doesn't resolve. To resolve the range
+// while walking the path for some other purpose, use a ByteRangeResolver.
+func (b Block) ResolveByteRange(
+	ctx context.Context,
+	path datamodel.Path,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+) (ByteRangeResolution, error) {
+	rv := NewByteRangeResolver(VisitorFunc(func(datamodel.Path, int, Block) {}), path, bytes)
+	if err := b.WalkContext(ctx, path, trustlessutils.DagScopeEntity, bytes, ignoreMissing, rv); err != nil {
+		return ByteRangeResolution{}, err
+	}
+	return rv.Resolution()
+}
+
+// ByteRangeResolver is a Visitor that resolves a byte range against the file at
+// the terminus of a path from the blocks visited by a walk of that path and
+// range, passing each block on to the wrapped Visitor. The blocks of the file
+// are therefore only loaded once. Resolution is available once the walk is
+// done.
+type ByteRangeResolver struct {
+	Visitor
+	path     string
+	bytes    trustlessutils.ByteRange
+	found    bool
+	terminus Block
+	last     Block
+	leaves   []Block
+}
+
+// NewByteRangeResolver creates a ByteRangeResolver for a walk, with v, of the
+// given UnixFS path and byte range.
+func NewByteRangeResolver(v Visitor, path datamodel.Path, bytes trustlessutils.ByteRange) *ByteRangeResolver {
+	return &ByteRangeResolver{Visitor: v, path: path.String(), bytes: bytes}
+}
+
+func (rv *ByteRangeResolver) Enter(p datamodel.Path, depth int, b Block) error {
+	rv.last = b
+	if !rv.found && b.UnixfsPath.String() == rv.path {
+		rv.found = true
+		rv.terminus = b
+	}
+	if rv.found {
+		rv.collect(b)
+	}
+	return rv.Visitor.Enter(p, depth, b)
+}
+
+func (rv *ByteRangeResolver) Missing(p datamodel.Path, depth int, b Block) error {
+	if rv.found {
+		rv.collect(b)
+	}
+	return visitMissing(rv.Visitor, p, depth, b)
+}
+
+// collect keeps the blocks of the file whose own data overlaps the range,
+// whether they are leaves or intermediate nodes holding data, and missing
+// blocks that may hold data in the range.
+func (rv *ByteRangeResolver) collect(b Block) {
+	if b.UnixfsPath.String() != rv.path {
+		return
+	}
+	switch b.DataType {
+	case data.Data_File, data.Data_Raw, DataType_RawLeaf, DataType_Missing:
+	default:
+		return
+	}
+	from, to, err := rv.terminus.resolveRange(rv.bytes)
+	if err != nil {
+		return
+	}
+	if size := b.dataSize(); size > 0 && from < to && b.ByteOffset < to && b.ByteOffset+size > from {
+		rv.leaves = append(rv.leaves, b)
+	}
+}
+
+// Resolution returns the resolution of the byte range against the file at the
+// terminus of the path walked, with the errors of ResolveByteRange.
+func (rv *ByteRangeResolver) Resolution() (ByteRangeResolution, error) {
+	if !rv.found {
+		return ByteRangeResolution{}, ErrUnsupportedDataType{Cid: rv.last.Cid, DataType: rv.last.DataTypeString()}
+	}
+	switch rv.terminus.DataType {
+	case data.Data_File, data.Data_Raw, DataType_RawLeaf:
+	default:
+		return ByteRangeResolution{}, ErrUnsupportedDataType{Cid: rv.terminus.Cid, DataType: rv.terminus.DataTypeString()}
+	}
+
+	from, to, err := rv.terminus.resolveRange(rv.bytes)
+	if err != nil {
+		return ByteRangeResolution{}, err
+	}
+	if to > rv.terminus.Length() {
+		to = rv.terminus.Length()
+	}
+	return ByteRangeResolution{
+		Requested: rv.bytes,
+		From:      from,
+		To:        to - 1,
+		Length:    rv.terminus.Length(),
+		Leaves:    rv.leaves,
+	}, nil
+}
+
+// dataSize is the number of bytes of the file held in the block itself, rather
+// than in its children. For a missing block, it is the number of bytes the
+// block was expected to cover.
+func (b Block) dataSize() int64 {
+	size := b.ByteSize
+	for _, bs := range b.BlockSizes {
+		size -= bs
+	}
+	return size
+}
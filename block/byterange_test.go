@@ -0,0 +1,158 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestResolveByteRange(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{name:"a"},file:1kB{name:"b"},dir{name:"c"}(file:1kB))`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	a, err := blk.Children[0].Block()
+	require.NoError(t, err)
+
+	i64 := func(i int64) *int64 { return &i }
+
+	testCases := []struct {
+		path        string
+		bytes       trustlessutils.ByteRange
+		from, to    int64
+		leaves      []int // indexes into the children of "a"
+		first, last int64
+	}{
+		{"a", trustlessutils.ByteRange{From: 1000, To: i64(300000)}, 1000, 300000, []int{0, 1}, 1000, 212287},
+		{"a", trustlessutils.ByteRange{From: -100}, 599900, 599999, []int{2}, 87612, 0},
+		{"a", trustlessutils.ByteRange{From: 0, To: i64(-1000)}, 0, 598999, []int{0, 1, 2}, 0, 1000}, // negative ends are exclusive
+		{"a", trustlessutils.ByteRange{From: 256144, To: i64(256144)}, 256144, 256144, []int{1}, 0, 256143},
+		{"a", trustlessutils.ByteRange{From: 500000, To: i64(10000000)}, 500000, 599999, []int{1, 2}, 243856, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.bytes.String(), func(t *testing.T) {
+			req := require.New(t)
+			res, err := blk.ResolveByteRange(context.Background(), datamodel.ParsePath(tc.path), tc.bytes, false)
+			req.NoError(err)
+			req.Equal(int64(600000), res.Length)
+			req.Equal(tc.from, res.From)
+			req.Equal(tc.to, res.To)
+			req.Len(res.Leaves, len(tc.leaves))
+			for ii, leaf := range tc.leaves {
+				req.Equal(a.Children[leaf].Cid, res.Leaves[ii].Cid)
+			}
+			req.Equal(tc.first, res.FirstWasted())
+			req.Equal(tc.last, res.LastWasted())
+		})
+	}
+
+	// single block file
+	res, err := blk.ResolveByteRange(context.Background(), datamodel.ParsePath("b"), trustlessutils.ByteRange{From: 10, To: i64(-10)}, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), res.From)
+	require.Equal(t, int64(989), res.To)
+	require.Len(t, res.Leaves, 1)
+	require.Equal(t, blk.Children[1].Cid, res.Leaves[0].Cid)
+	require.Equal(t, int64(10), res.FirstWasted())
+	require.Equal(t, int64(10), res.LastWasted())
+
+	var buf bytes.Buffer
+	res.Write(&buf)
+	require.Equal(t, fmt.Sprintf(`Byte range 10:-10 resolves to [10:989] of 1,000 B
+  1 leaf block overlaps, %s [0:999]
+  10 B wasted before the range in the first leaf, 10 B after it in the last
+`, blk.Children[1].Cid), buf.String())
+
+	// a start beyond the end, and an end that reaches back before the start,
+	// both select nothing, for different reasons
+	for _, tc := range []struct {
+		br       trustlessutils.ByteRange
+		expected string
+	}{
+		{trustlessutils.ByteRange{From: 1000}, "Byte range 1000:* starts at or beyond the end of the entity of 1,000 B\n"},
+		{trustlessutils.ByteRange{From: 0, To: i64(-1000)}, "Byte range 0:-1000 is empty, its end resolves to at or before its start of 0 in the entity of 1,000 B\n"},
+		{trustlessutils.ByteRange{From: 0, To: i64(-2000)}, "Byte range 0:-2000 is empty, its end resolves to at or before its start of 0 in the entity of 1,000 B\n"},
+		{trustlessutils.ByteRange{From: 10, To: i64(-990)}, "Byte range 10:-990 is empty, its end resolves to at or before its start of 10 in the entity of 1,000 B\n"},
+	} {
+		res, err := blk.ResolveByteRange(context.Background(), datamodel.ParsePath("b"), tc.br, false)
+		require.NoError(t, err)
+		require.Empty(t, res.Leaves)
+		buf.Reset()
+		res.Write(&buf)
+		require.Equal(t, tc.expected, buf.String())
+	}
+
+	// not a file
+	_, err = blk.ResolveByteRange(context.Background(), datamodel.ParsePath("c"), trustlessutils.ByteRange{From: 10}, false)
+	var unsupported ErrUnsupportedDataType
+	require.True(t, errors.As(err, &unsupported))
+	require.Equal(t, "Directory", unsupported.DataType)
+
+	// invalid
+	_, err = blk.ResolveByteRange(context.Background(), datamodel.ParsePath("a"), trustlessutils.ByteRange{From: -100, To: i64(-1000)}, false)
+	var invalid ErrInvalidByteRange
+	require.True(t, errors.As(err, &invalid))
+
+	// resolved from a walk, which still sees every block
+	var visited int
+	resolver := NewByteRangeResolver(VisitorFunc(func(p datamodel.Path, depth int, b Block) { visited++ }), datamodel.ParsePath("a"), trustlessutils.ByteRange{From: 300000, To: i64(300001)})
+	require.NoError(t, blk.Walk(datamodel.ParsePath("a"), trustlessutils.DagScopeEntity, trustlessutils.ByteRange{From: 300000, To: i64(300001)}, false, resolver))
+	require.Equal(t, 3, visited)
+	res, err = resolver.Resolution()
+	require.NoError(t, err)
+	require.Len(t, res.Leaves, 1)
+	require.Equal(t, a.Children[1].Cid, res.Leaves[0].Cid)
+
+	// intermediate nodes holding data are leaves too, where their own data
+	// overlaps the range
+	entity, err = generator.Parse(`file:2500B{chunk:1kB,fanout:2,inline:1kB}`)
+	require.NoError(t, err)
+	rootEnt, err = entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err = NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	inline := int64(len(blockData(t, blk)))
+	require.True(t, inline > 0)
+	for _, br := range [][2]int64{{0, 0}, {inline - 1, inline}, {inline, 2499}} {
+		expected := make([]Block, 0)
+		require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeEntity, trustlessutils.ByteRange{From: br[0], To: i64(br[1])}, false, func(p datamodel.Path, depth int, b Block) {
+			if size := int64(len(blockData(t, b))); size > 0 && b.ByteOffset <= br[1] && b.ByteOffset+size > br[0] {
+				expected = append(expected, b)
+			}
+		}))
+		res, err := blk.ResolveByteRange(context.Background(), datamodel.Path{}, trustlessutils.ByteRange{From: br[0], To: i64(br[1])}, false)
+		require.NoError(t, err)
+		require.Len(t, res.Leaves, len(expected), "range %v", br)
+		for ii := range expected {
+			require.Equal(t, expected[ii].Cid, res.Leaves[ii].Cid, "range %v", br)
+		}
+		first, last := expected[0], expected[len(expected)-1]
+		require.Equal(t, br[0]-first.ByteOffset, res.FirstWasted(), "range %v", br)
+		require.Equal(t, last.ByteOffset+int64(len(blockData(t, last)))-1-br[1], res.LastWasted(), "range %v", br)
+	}
+	res, err = blk.ResolveByteRange(context.Background(), datamodel.Path{}, trustlessutils.ByteRange{From: 0, To: i64(0)}, false)
+	require.NoError(t, err)
+	require.Len(t, res.Leaves, 1)
+	require.Equal(t, blk.Cid, res.Leaves[0].Cid)
+	require.Equal(t, inline-1, res.LastWasted())
+}
@@ -0,0 +1,143 @@
+package block
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// Entity is a summary of a UnixFS entity (file, directory, etc.) or IPLD node
+// at a path within a DAG, made up of the blocks that share its UnixFS path.
+type Entity struct {
+	Path     datamodel.Path
+	Cid      cid.Cid // of the root block of the entity
+	DataType string
+	Length   int64   // of a file
+	Blocks   int     // the number of blocks that make up the entity, including HAMT shards
+	Leaves   []int64 // the sizes of the leaf blocks of a file, in order
+}
+
+// EntityChange is an entity that exists at the same path in two DAGs, but with
+// a different CID.
+type EntityChange struct {
+	A, B Entity
+}
+
+// TypeChanged reports whether the data type of the entity changed, e.g. from a
+// plain to a HAMT sharded directory.
+func (c EntityChange) TypeChanged() bool {
+	return c.A.DataType != c.B.DataType
+}
+
+// LengthChanged reports whether the length of a file changed.
+func (c EntityChange) LengthChanged() bool {
+	return c.A.Length != c.B.Length
+}
+
+// ChunkingChanged reports whether the leaf blocks of a file are of different
+// sizes.
+func (c EntityChange) ChunkingChanged() bool {
+	if len(c.A.Leaves) != len(c.B.Leaves) {
+		return true
+	}
+	for ii := range c.A.Leaves {
+		if c.A.Leaves[ii] != c.B.Leaves[ii] {
+			return true
+		}
+	}
+	return false
+}
+
+// ShapeChanged reports whether the entity is made up of a different number of
+// blocks, such as a file with the same chunking but a different layout, or a
+// HAMT with a different fanout.
+func (c EntityChange) ShapeChanged() bool {
+	return c.A.Blocks != c.B.Blocks
+}
+
+// DagDiff is the difference between two DAGs at the UnixFS level.
+type DagDiff struct {
+	Added   []Entity       // entities only in B, in traversal order
+	Removed []Entity       // entities only in A, in traversal order
+	Changed []EntityChange // entities at the same path with different CIDs, in the traversal order of A
+	Shared  int            // the number of distinct blocks in both DAGs
+	OnlyA   int            // the number of distinct blocks only in A
+	OnlyB   int            // the number of distinct blocks only in B
+}
+
+// Diff walks the full DAGs rooted at a and b and compares the entities found
+// at each UnixFS path, along with the blocks they have in common.
+func Diff(ctx context.Context, a, b Block) (DagDiff, error) {
+	entitiesA, blocksA, err := a.entities(ctx)
+	if err != nil {
+		return DagDiff{}, err
+	}
+	entitiesB, blocksB, err := b.entities(ctx)
+	if err != nil {
+		return DagDiff{}, err
+	}
+
+	var diff DagDiff
+	byPathB := make(map[string]Entity, len(entitiesB))
+	for _, e := range entitiesB {
+		byPathB[e.Path.String()] = e
+	}
+	byPathA := make(map[string]struct{}, len(entitiesA))
+	for _, ea := range entitiesA {
+		byPathA[ea.Path.String()] = struct{}{}
+		eb, ok := byPathB[ea.Path.String()]
+		if !ok {
+			diff.Removed = append(diff.Removed, ea)
+		} else if ea.Cid != eb.Cid {
+			diff.Changed = append(diff.Changed, EntityChange{ea, eb})
+		}
+	}
+	for _, eb := range entitiesB {
+		if _, ok := byPathA[eb.Path.String()]; !ok {
+			diff.Added = append(diff.Added, eb)
+		}
+	}
+
+	for c := range blocksA {
+		if _, ok := blocksB[c]; ok {
+			diff.Shared++
+		} else {
+			diff.OnlyA++
+		}
+	}
+	diff.OnlyB = len(blocksB) - diff.Shared
+	return diff, nil
+}
+
+// entities walks the full DAG and groups the blocks into entities by UnixFS
+// path, in traversal order, along with the set of distinct blocks.
+func (b Block) entities(ctx context.Context) ([]Entity, map[cid.Cid]struct{}, error) {
+	entities := make([]Entity, 0)
+	index := make(map[string]int)
+	blocks := make(map[cid.Cid]struct{})
+	err := b.NavigateContext(ctx, datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, blk Block) {
+		blocks[blk.Cid] = struct{}{}
+		ii, ok := index[blk.UnixfsPath.String()]
+		if !ok {
+			ii = len(entities)
+			index[blk.UnixfsPath.String()] = ii
+			entities = append(entities, Entity{
+				Path:     blk.UnixfsPath,
+				Cid:      blk.Cid,
+				DataType: blk.DataTypeString(),
+			})
+			switch blk.DataType {
+			case data.Data_File, data.Data_Raw, DataType_RawLeaf:
+				entities[ii].Length = blk.Length()
+			}
+		}
+		entities[ii].Blocks++
+		if len(blk.Children) == 0 && entities[ii].Length > 0 {
+			entities[ii].Leaves = append(entities[ii].Leaves, blk.ByteSize)
+		}
+	})
+	return entities, blocks, err
+}
@@ -0,0 +1,85 @@
+package block
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/test-go/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	generate := func(spec string) Block {
+		entity, err := generator.Parse(spec)
+		require.NoError(t, err)
+		rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+		require.NoError(t, err)
+		blk, err := NewBlock(lsys, rootEnt.Root)
+		require.NoError(t, err)
+		return blk
+	}
+	a := generate(`dir(file:600kB{zero,name:"a"},file:1kB{zero,name:"b"},file:1kB{zero,name:"c"},dir{name:"x"}(file:1kB{zero,name:"y"}))`)
+	b := generate(`dir(file:600kB{zero,name:"a",chunk:100kB},file:1kB{zero,name:"b"},file:2kB{zero,name:"d"},dir{name:"x",sharded}(file:1kB{zero,name:"y"}))`)
+
+	diff, err := Diff(context.Background(), a, b)
+	require.NoError(t, err)
+
+	paths := func(entities []Entity) []string {
+		ps := make([]string, 0)
+		for _, e := range entities {
+			ps = append(ps, e.Path.String())
+		}
+		return ps
+	}
+	require.Equal(t, []string{"c"}, paths(diff.Removed))
+	require.Equal(t, []string{"d"}, paths(diff.Added))
+	require.Equal(t, int64(2000), diff.Added[0].Length)
+	require.Equal(t, []int64{2000}, diff.Added[0].Leaves)
+
+	require.Len(t, diff.Changed, 3)
+	root, fileA, dirX := diff.Changed[0], diff.Changed[1], diff.Changed[2]
+
+	require.Equal(t, "", root.A.Path.String())
+	require.False(t, root.TypeChanged())
+	require.False(t, root.ShapeChanged())
+
+	require.Equal(t, "a", fileA.A.Path.String())
+	require.False(t, fileA.TypeChanged())
+	require.False(t, fileA.LengthChanged())
+	require.True(t, fileA.ChunkingChanged())
+	require.True(t, fileA.ShapeChanged())
+	require.Equal(t, []int64{256144, 256144, 87712}, fileA.A.Leaves)
+	require.Equal(t, []int64{100000, 100000, 100000, 100000, 100000, 100000}, fileA.B.Leaves)
+	require.Equal(t, 4, fileA.A.Blocks)
+	require.Equal(t, 7, fileA.B.Blocks)
+
+	require.Equal(t, "x", dirX.A.Path.String())
+	require.True(t, dirX.TypeChanged())
+	require.Equal(t, "Directory", dirX.A.DataType)
+	require.Equal(t, "HAMTShard", dirX.B.DataType)
+
+	// the 1kB zero files, "b", "c" and "x/y" are the same block in both, "d" and
+	// the 100kB chunks are new
+	require.Equal(t, 1, diff.Shared)
+	require.Equal(t, 2+1+1+1, diff.OnlyA)   // root, "a" file + 2 distinct chunks, "x"
+	require.Equal(t, 1+1+1+1+1, diff.OnlyB) // root, "a" file + 1 distinct chunk, "d", "x"
+
+	diff, err = Diff(context.Background(), a, a)
+	require.NoError(t, err)
+	require.Empty(t, diff.Added)
+	require.Empty(t, diff.Removed)
+	require.Empty(t, diff.Changed)
+	require.Equal(t, 0, diff.OnlyA)
+	require.Equal(t, 0, diff.OnlyB)
+}
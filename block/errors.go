@@ -0,0 +1,71 @@
+package block
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// ErrPathNotFound is returned when a segment of the query path can't be
+// found. This is the equivalent of a 404 from a trustless gateway.
+type ErrPathNotFound struct {
+	Segment  datamodel.PathSegment
+	At       datamodel.Path // the path at which Segment was looked for
+	DataType string         // the data type of the block Segment was looked for in
+}
+
+func (e ErrPathNotFound) Error() string {
+	return fmt.Sprintf("segment not found in %s: %s (at /%s)", e.DataType, e.Segment.String(), e.At.String())
+}
+
+// ErrUnsupportedDataType is returned when a block of a type that can't be
+// navigated or interpreted is encountered, such as a path through a file or a
+// UnixFS symlink.
+type ErrUnsupportedDataType struct {
+	Cid      cid.Cid
+	DataType string
+}
+
+func (e ErrUnsupportedDataType) Error() string {
+	return fmt.Sprintf("unsupported %s (%s)", e.DataType, e.Cid.String())
+}
+
+// ErrInvalidByteRange is returned when the requested byte range doesn't
+// resolve to a valid range of the entity at the terminus of the path. This is
+// the equivalent of a 416 from a trustless gateway.
+type ErrInvalidByteRange struct {
+	Requested trustlessutils.ByteRange
+	Resolved  trustlessutils.ByteRange // after resolving negative offsets
+	Length    int64                    // of the entity
+}
+
+func (e ErrInvalidByteRange) Error() string {
+	return fmt.Sprintf("invalid range (len=%d) %s (orig=%s)", e.Length, e.Resolved.String(), e.Requested.String())
+}
+
+// ErrMissingBlock is returned when a block can't be found by the LinkSystem.
+// The underlying storage error is available with errors.Unwrap.
+type ErrMissingBlock struct {
+	Cid  cid.Cid
+	Path datamodel.Path // the UnixFS path of the block
+	Err  error
+}
+
+func (e ErrMissingBlock) Error() string {
+	return fmt.Sprintf("missing block %s at /%s: %s", e.Cid.String(), e.Path.String(), e.Err.Error())
+}
+
+func (e ErrMissingBlock) Unwrap() error {
+	return e.Err
+}
+
+func (e ErrMissingBlock) NotFound() bool {
+	return true
+}
+
+func isNotFound(err error) bool {
+	nf, ok := err.(interface{ NotFound() bool })
+	return ok && nf.NotFound()
+}
@@ -0,0 +1,54 @@
+package block
+
+import (
+	"context"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// ExtractCAR writes a CARv1 to w, rooted at b, containing exactly the blocks
+// that Navigate visits for the query, in traversal order. This is the
+// response a trustless gateway is expected to produce for the same request.
+// If duplicates is false, each block is only written the first time it is
+// visited, as with dups=n.
+func (b Block) ExtractCAR(
+	ctx context.Context,
+	w io.Writer,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+) error {
+	// hide any io.WriterAt so that the CAR is always streamed in order, which
+	// also allows w to be a pipe
+	car, err := carstorage.NewWritable(struct{ io.Writer }{w}, []cid.Cid{b.Cid}, carv2.WriteAsCarV1(true), carv2.AllowDuplicatePuts(duplicates), carv2.UseWholeCIDs(true))
+	if err != nil {
+		return err
+	}
+	return b.WalkContext(ctx, path, scope, bytes, false, &extractingVisitor{ctx: ctx, car: car})
+}
+
+// extractingVisitor writes the raw bytes of each block entered to a CAR.
+type extractingVisitor struct {
+	ctx context.Context
+	car carstorage.WritableCar
+}
+
+func (ev *extractingVisitor) Enter(p datamodel.Path, depth int, b Block) error {
+	byts, err := b.ls.LoadRaw(linking.LinkContext{Ctx: ev.ctx}, cidlink.Link{Cid: b.Cid})
+	if err != nil {
+		return err
+	}
+	return ev.car.Put(ev.ctx, b.Cid.KeyString(), byts)
+}
+
+func (ev *extractingVisitor) Leave(p datamodel.Path, depth int, b Block) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestExtractCAR(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	to := int64(300000)
+	testCases := []struct {
+		name       string
+		path       string
+		scope      trustlessutils.DagScope
+		bytes      trustlessutils.ByteRange
+		duplicates bool
+		expected   int
+	}{
+		{"all", "", trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, true, 6},
+		{"all, no dups", "", trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, 5}, // the first two chunks of "a" are identical
+		{"entity range", "a", trustlessutils.DagScopeEntity, trustlessutils.ByteRange{From: 1000, To: &to}, true, 4},
+		{"block", "b", trustlessutils.DagScopeBlock, trustlessutils.ByteRange{}, true, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := require.New(t)
+			expected := make([]cid.Cid, 0)
+			seen := make(map[cid.Cid]struct{})
+			req.NoError(blk.Navigate(datamodel.ParsePath(tc.path), tc.scope, tc.bytes, false, func(p datamodel.Path, depth int, b Block) {
+				if _, ok := seen[b.Cid]; ok && !tc.duplicates {
+					return
+				}
+				seen[b.Cid] = struct{}{}
+				expected = append(expected, b.Cid)
+			}))
+			req.Len(expected, tc.expected)
+
+			var buf bytes.Buffer
+			req.NoError(blk.ExtractCAR(context.Background(), &buf, datamodel.ParsePath(tc.path), tc.scope, tc.bytes, tc.duplicates))
+
+			cr, err := carv2.NewBlockReader(&buf)
+			req.NoError(err)
+			req.Equal([]cid.Cid{rootEnt.Root}, cr.Roots)
+			actual := make([]cid.Cid, 0)
+			for {
+				b, err := cr.Next()
+				if err == io.EOF {
+					break
+				}
+				req.NoError(err)
+				byts, err := lsys.LoadRaw(linking.LinkContext{}, cidlink.Link{Cid: b.Cid()})
+				req.NoError(err)
+				req.Equal(byts, b.RawData())
+				actual = append(actual, b.Cid())
+			}
+			req.Equal(expected, actual)
+		})
+	}
+}
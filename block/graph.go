@@ -0,0 +1,229 @@
+package block
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// Graph collects the blocks visited by a traversal, and the links between
+// them, so they can be rendered as a Graphviz or Mermaid diagram. Blocks that
+// are visited more than once are drawn once, with an edge for each distinct
+// link to them. Blocks along the query path, up to and including the blocks
+// of the entity at its terminus, are highlighted.
+type Graph struct {
+	path     datamodel.Path
+	ipldPath bool
+
+	nodes     []graphNode
+	nodeIndex map[cid.Cid]int
+	edges     []graphEdge
+	edgeSeen  map[graphEdge]struct{}
+	stack     []int // node index of the current block at each depth
+}
+
+type graphNode struct {
+	blk       Block
+	highlight bool
+}
+
+type graphEdge struct {
+	from, to int
+	label    string
+}
+
+// NewGraph creates a Graph for a traversal of the given query path. If
+// ipldPath is true, the path is a raw IPLD data model path, as used with
+// NavigateIpld, and edges are labelled with IPLD paths.
+func NewGraph(path datamodel.Path, ipldPath bool) *Graph {
+	return &Graph{
+		path:      path,
+		ipldPath:  ipldPath,
+		nodeIndex: make(map[cid.Cid]int),
+		edgeSeen:  make(map[graphEdge]struct{}),
+	}
+}
+
+func (g *Graph) pathOf(blk Block) datamodel.Path {
+	if g.ipldPath {
+		return blk.IpldPath
+	}
+	return blk.UnixfsPath
+}
+
+// Visit is a visitor function for Navigate and NavigateIpld.
+func (g *Graph) Visit(p datamodel.Path, depth int, blk Block) {
+	idx, ok := g.nodeIndex[blk.Cid]
+	if !ok {
+		idx = len(g.nodes)
+		g.nodeIndex[blk.Cid] = idx
+		g.nodes = append(g.nodes, graphNode{blk: blk})
+	}
+
+	if depth > len(g.stack) {
+		depth = len(g.stack) // shouldn't happen for a depth-first traversal
+	}
+	g.stack = append(g.stack[:depth], idx)
+
+	if depth == 0 {
+		g.nodes[idx].highlight = true
+		return
+	}
+
+	parent := g.nodes[g.stack[depth-1]]
+	if parent.highlight && isPrefix(g.pathOf(blk), g.path) && g.onHamtPath(depth, blk) {
+		g.nodes[idx].highlight = true
+	}
+	edge := graphEdge{from: g.stack[depth-1], to: idx, label: g.edgeLabel(parent.blk, blk)}
+	if _, ok := g.edgeSeen[edge]; !ok {
+		g.edgeSeen[edge] = struct{}{}
+		g.edges = append(g.edges, edge)
+	}
+}
+
+// onHamtPath reports whether a HAMT shard is one that navigating the path
+// passes through. Every shard of a sharded directory has the directory's
+// UnixFS path, so only the shards holding the next segment of the path, as
+// chosen by its hash, are on it. All shards of a directory at the terminus of
+// the path belong to its entity.
+func (g *Graph) onHamtPath(depth int, blk Block) bool {
+	if g.ipldPath || blk.DataType != data.Data_HAMTShard || blk.UnixfsPath.Len() >= g.path.Len() {
+		return true
+	}
+	// the level of the shard within the HAMT, the root shard being 0
+	level := 0
+	for _, idx := range g.stack[:depth] {
+		anc := g.nodes[idx].blk
+		if anc.DataType == data.Data_HAMTShard && anc.UnixfsPath.String() == blk.UnixfsPath.String() {
+			level++
+		}
+	}
+	if level == 0 {
+		return true
+	}
+	key := g.path.Segments()[blk.UnixfsPath.Len()].String()
+	shardIndex, err := hamtShardIndex(key, blk.Arity, level)
+	return err == nil && shardIndex == blk.ShardIndex
+}
+
+// edgeLabel is the link name, the path within the parent, the byte range of a
+// file chunk, or the index of a HAMT shard.
+func (g *Graph) edgeLabel(parent, child Block) string {
+	pp, cp := g.pathOf(parent), g.pathOf(child)
+	if cp.Len() > pp.Len() {
+		return datamodel.NewPath(cp.Segments()[pp.Len():]).String()
+	}
+	if parent.DataType == data.Data_File && child.ByteSize > 0 {
+		return fmt.Sprintf("[%d:%d]", child.ByteOffset, child.ByteOffset+child.ByteSize-1)
+	}
+	return child.ShardIndex
+}
+
+func (g *Graph) nodeLabel(blk Block) []string {
+	label := []string{shortCid(blk.Cid), blk.DataTypeString()}
+	if blk.ByteSize > 0 {
+		label = append(label, humanize.Comma(blk.ByteSize)+" B")
+	}
+	return label
+}
+
+// WriteDot renders the graph in Graphviz DOT form.
+func (g *Graph) WriteDot(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph dag {\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for ii, n := range g.nodes {
+		label := make([]string, 0)
+		for _, l := range g.nodeLabel(n.blk) {
+			label = append(label, dotEscape(l))
+		}
+		fmt.Fprintf(&sb, "  n%d [label=\"%s\"", ii, strings.Join(label, "\\n"))
+		if n.highlight {
+			sb.WriteString(", color=red, penwidth=2")
+		}
+		sb.WriteString("];\n")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&sb, "  n%d -> n%d", e.from, e.to)
+		attrs := make([]string, 0)
+		if e.label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=\"%s\"", dotEscape(e.label)))
+		}
+		if g.nodes[e.from].highlight && g.nodes[e.to].highlight {
+			attrs = append(attrs, "color=red", "penwidth=2")
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, " [%s]", strings.Join(attrs, ", "))
+		}
+		sb.WriteString(";\n")
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteMermaid renders the graph as a Mermaid flowchart.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	highlighted := make([]string, 0)
+	for ii, n := range g.nodes {
+		label := make([]string, 0)
+		for _, l := range g.nodeLabel(n.blk) {
+			label = append(label, mermaidEscape(l))
+		}
+		fmt.Fprintf(&sb, "  n%d[\"%s\"]\n", ii, strings.Join(label, "<br/>"))
+		if n.highlight {
+			highlighted = append(highlighted, fmt.Sprintf("n%d", ii))
+		}
+	}
+	highlightedEdges := make([]string, 0)
+	for ii, e := range g.edges {
+		if e.label != "" {
+			fmt.Fprintf(&sb, "  n%d -->|\"%s\"| n%d\n", e.from, mermaidEscape(e.label), e.to)
+		} else {
+			fmt.Fprintf(&sb, "  n%d --> n%d\n", e.from, e.to)
+		}
+		if g.nodes[e.from].highlight && g.nodes[e.to].highlight {
+			highlightedEdges = append(highlightedEdges, fmt.Sprintf("%d", ii))
+		}
+	}
+	if len(highlighted) > 0 {
+		sb.WriteString("  classDef path stroke:#d00,stroke-width:3px\n")
+		fmt.Fprintf(&sb, "  class %s path\n", strings.Join(highlighted, ","))
+	}
+	if len(highlightedEdges) > 0 {
+		fmt.Fprintf(&sb, "  linkStyle %s stroke:#d00,stroke-width:3px\n", strings.Join(highlightedEdges, ","))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// isPrefix checks whether p is equal to, or a parent of, of.
+func isPrefix(p, of datamodel.Path) bool {
+	if p.Len() > of.Len() {
+		return false
+	}
+	return datamodel.NewPath(of.Segments()[:p.Len()]).String() == p.String()
+}
+
+func shortCid(c cid.Cid) string {
+	s := c.String()
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:8] + "…" + s[len(s)-6:]
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,82 @@
+package block
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestGraph(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	graph := NewGraph(datamodel.ParsePath("a"), false)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, graph.Visit))
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDot(&buf))
+	dot := buf.String()
+	// directory, file, two distinct leaves and the small file
+	require.Equal(t, 3, strings.Count(dot, `\nRawLeaf`))
+	require.Equal(t, 5, strings.Count(dot, " -> "))
+	// the shared zero leaf has an edge for each of the byte ranges it covers
+	require.Contains(t, dot, `n1 -> n2 [label="[0:256143]", color=red, penwidth=2];`)
+	require.Contains(t, dot, `n1 -> n2 [label="[256144:512287]", color=red, penwidth=2];`)
+	require.Contains(t, dot, `n0 -> n4 [label="b"];`)
+
+	buf.Reset()
+	require.NoError(t, graph.WriteMermaid(&buf))
+	require.Contains(t, buf.String(), "  class n0,n1,n2,n3 path\n")
+	require.Contains(t, buf.String(), `  n0 -->|"b"| n4`)
+
+	// of the shards of a sharded directory, only those that navigating the path
+	// passes through are highlighted when drawing the whole DAG
+	entity, err = generator.Parse(`dir(dir{name:"c",sharded}(file:1kB{name:"x"},300*file:1kB))`)
+	require.NoError(t, err)
+	rootEnt, err = entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err = NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	onPath := make(map[cid.Cid]struct{})
+	require.NoError(t, blk.Navigate(datamodel.ParsePath("c/x"), trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b Block) {
+		onPath[b.Cid] = struct{}{}
+	}))
+	require.True(t, len(onPath) > 3, "expected a multi-level HAMT")
+	graph = NewGraph(datamodel.ParsePath("c/x"), false)
+	var shards int
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b Block) {
+		if b.DataType == data.Data_HAMTShard {
+			shards++
+		}
+		graph.Visit(p, depth, b)
+	}))
+	require.True(t, shards > len(onPath))
+	highlighted := make(map[cid.Cid]struct{})
+	for _, n := range graph.nodes {
+		if n.highlight {
+			highlighted[n.blk.Cid] = struct{}{}
+		}
+	}
+	require.Equal(t, onPath, highlighted)
+}
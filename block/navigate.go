@@ -1,6 +1,7 @@
 package block
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -17,6 +18,9 @@ import (
 	trustlesshttp "github.com/ipld/go-trustless-utils/http"
 )
 
+// Navigate performs a trustless query across the DAG rooted at b, calling
+// visitFn for each block in traversal order. It is the same as Walk with the
+// function adapted as a VisitorFunc.
 func (b Block) Navigate(
 	path datamodel.Path,
 	scope trustlessutils.DagScope,
@@ -24,7 +28,63 @@ func (b Block) Navigate(
 	ignoreMissing bool,
 	visitFn func(p datamodel.Path, depth int, b Block),
 ) error {
-	visitFn(datamodel.Path{}, 0, b)
+	return b.WalkContext(context.Background(), path, scope, bytes, ignoreMissing, VisitorFunc(visitFn))
+}
+
+// NavigateContext is the same as Navigate, but the context is passed to the
+// LinkSystem for each block loaded, and the traversal stops with the
+// context's error once it is done.
+func (b Block) NavigateContext(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	visitFn func(p datamodel.Path, depth int, b Block),
+) error {
+	return b.WalkContext(ctx, path, scope, bytes, ignoreMissing, VisitorFunc(visitFn))
+}
+
+// Walk performs a trustless query across the DAG rooted at b, entering and
+// leaving each block with the visitor in traversal order. Blocks along the
+// query path are left after the traversal of the terminating entity is
+// complete.
+func (b Block) Walk(
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	v Visitor,
+) error {
+	return b.WalkContext(context.Background(), path, scope, bytes, ignoreMissing, v)
+}
+
+// WalkContext is the same as Walk, but the context is passed to the
+// LinkSystem for each block loaded, and the traversal stops with the
+// context's error once it is done.
+func (b Block) WalkContext(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	v Visitor,
+) error {
+	pv := &pathVisitor{Visitor: v}
+	return pv.finish(b.walk(ctx, path, scope, bytes, ignoreMissing, pv))
+}
+
+func (b Block) walk(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	pv *pathVisitor,
+) error {
+	if err := pv.enter(datamodel.Path{}, 0, b); err != nil {
+		return err
+	}
 
 	progress := datamodel.Path{}
 	curr := b
@@ -37,73 +97,260 @@ outer:
 		progress = progress.AppendSegment(nextSeg)
 
 		switch int64(curr.DataType) {
-		case data.Data_Directory:
-			for _, child := range curr.Children {
-				if child.UnixfsPath.String() == progress.String() {
-					blk, err := child.Block()
-					if fatalErr(ignoreMissing, err) {
-						return err
-					} else if err != nil {
-						continue
-					}
-					depth++
-					visitFn(progress, depth, blk)
-					curr = blk
-					if scope == trustlessutils.DagScopeEntity && path.Len() == 0 {
-						break outer
-					}
-					continue outer
+		case data.Data_Directory, DataType_Node:
+			child, found, err := curr.enterChild(ctx, progress, depth+1, ignoreMissing, pv)
+			if err != nil {
+				return err
+			}
+			if found {
+				if child.DataType == DataType_Missing {
+					// the rest of the path can't be followed
+					return pv.leave()
 				}
+				depth++
+				curr = child
+				if scope == trustlessutils.DagScopeEntity && path.Len() == 0 {
+					break outer
+				}
+				continue outer
+			}
+			// not a link, but may be a path within the node itself
+			if curr.DataType == DataType_Node && curr.hasPath(curr.UnixfsPath, progress) {
+				continue outer
 			}
 		case data.Data_HAMTShard:
-			child, _depth, found, err := curr.findInHamt(progress, depth+1, ignoreMissing, visitFn)
+			child, _depth, found, err := curr.findInHamt(ctx, progress, depth+1, ignoreMissing, pv)
 			if err != nil {
 				return err
 			}
 			if !found {
-				return errors.New("not found in HAMT")
+				return ErrPathNotFound{Segment: nextSeg, At: progress.Pop(), DataType: curr.DataTypeString()}
+			}
+			if child.DataType == DataType_Missing {
+				// the rest of the path can't be followed
+				return pv.leave()
 			}
 			depth = _depth
-			visitFn(progress, depth, child)
+			if err := pv.enter(progress, depth, child); err != nil {
+				return err
+			}
 			curr = child
 			if scope == trustlessutils.DagScopeEntity && path.Len() == 0 {
 				break outer
 			}
 			continue outer
 		default:
-			return errors.New("unsupported " + data.DataTypeNames[int64(curr.DataType)])
+			return ErrUnsupportedDataType{Cid: curr.Cid, DataType: curr.DataTypeString()}
+		}
+
+		return ErrPathNotFound{Segment: nextSeg, At: progress.Pop(), DataType: curr.DataTypeString()}
+	}
+
+	if curr.DataType == DataType_Node && progress.Len() > curr.UnixfsPath.Len() {
+		// path terminates within the node, only links below that point are in
+		// scope, and only if we are exploring all
+		if scope != trustlessutils.DagScopeAll {
+			return pv.leave()
 		}
+		curr.Children = curr.childrenUnder(progress, false)
+	}
 
-		return fmt.Errorf("segment not found in %s: %s / %s", data.DataTypeNames[curr.DataType], nextSeg.String(), path.String())
+	if err := curr.visitScope(ctx, progress, scope, bytes, depth+1, ignoreMissing, pv.Visitor); err != nil {
+		return err
 	}
+	return pv.leave()
+}
 
+// NavigateIpld is the same as Navigate, but the path is interpreted as a raw
+// IPLD data model path through the blocks (e.g. Links/3/Hash for dag-pb),
+// rather than as a UnixFS path. This mirrors a selector-based client that
+// doesn't interpret UnixFS data when following the path. The scope and byte
+// range are applied at the terminus of the path as they are in Navigate.
+func (b Block) NavigateIpld(
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	visitFn func(p datamodel.Path, depth int, b Block),
+) error {
+	return b.WalkIpldContext(context.Background(), path, scope, bytes, ignoreMissing, VisitorFunc(visitFn))
+}
+
+// NavigateIpldContext is the same as NavigateIpld, with a context as for
+// NavigateContext.
+func (b Block) NavigateIpldContext(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	visitFn func(p datamodel.Path, depth int, b Block),
+) error {
+	return b.WalkIpldContext(ctx, path, scope, bytes, ignoreMissing, VisitorFunc(visitFn))
+}
+
+// WalkIpld is the same as Walk, but the path is interpreted as a raw IPLD data
+// model path, as with NavigateIpld.
+func (b Block) WalkIpld(
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	v Visitor,
+) error {
+	return b.WalkIpldContext(context.Background(), path, scope, bytes, ignoreMissing, v)
+}
+
+// WalkIpldContext is the same as WalkIpld, with a context as for WalkContext.
+func (b Block) WalkIpldContext(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	v Visitor,
+) error {
+	pv := &pathVisitor{Visitor: v}
+	return pv.finish(b.walkIpld(ctx, path, scope, bytes, ignoreMissing, pv))
+}
+
+func (b Block) walkIpld(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	ignoreMissing bool,
+	pv *pathVisitor,
+) error {
+	if err := pv.enter(datamodel.Path{}, 0, b); err != nil {
+		return err
+	}
+
+	progress := datamodel.Path{}
+	curr := b
+	depth := 0
+
+outer:
+	for path.Len() > 0 {
+		var nextSeg datamodel.PathSegment
+		nextSeg, path = path.Shift()
+		progress = progress.AppendSegment(nextSeg)
+
+		for ii, child := range curr.Children {
+			if child.IpldPath.String() == progress.String() {
+				blk, err := child.BlockContext(ctx)
+				if fatalErr(ignoreMissing, err) {
+					return err
+				} else if err != nil {
+					if err := visitMissing(pv.Visitor, progress, depth+1, curr.missingChild(ii)); err != nil {
+						return err
+					}
+					// the rest of the path can't be followed
+					return pv.leave()
+				}
+				depth++
+				if err := pv.enter(progress, depth, blk); err != nil {
+					return err
+				}
+				curr = blk
+				continue outer
+			}
+		}
+		// not a link, but may be a path within the node itself
+		if curr.hasPath(curr.IpldPath, progress) {
+			continue
+		}
+
+		return ErrPathNotFound{Segment: nextSeg, At: progress.Pop(), DataType: curr.DataTypeString()}
+	}
+
+	if progress.Len() > curr.IpldPath.Len() {
+		// path terminates within the node, only links below that point are in
+		// scope, and only if we are exploring all
+		if scope != trustlessutils.DagScopeAll {
+			return pv.leave()
+		}
+		curr.Children = curr.childrenUnder(progress, true)
+	}
+
+	if err := curr.visitScope(ctx, progress, scope, bytes, depth+1, ignoreMissing, pv.Visitor); err != nil {
+		return err
+	}
+	return pv.leave()
+}
+
+func (b Block) visitScope(ctx context.Context, p datamodel.Path, scope trustlessutils.DagScope, bytes trustlessutils.ByteRange, depth int, ignoreMissing bool, v Visitor) error {
 	switch scope {
 	case trustlessutils.DagScopeBlock:
 		return nil
 	case trustlessutils.DagScopeEntity:
-		return curr.visitAllEntity(progress, bytes, depth+1, ignoreMissing, visitFn)
+		return b.visitAllEntity(ctx, p, bytes, depth, ignoreMissing, v)
 	}
 
-	return curr.visitAll(progress, depth+1, ignoreMissing, visitFn)
+	return b.visitAll(ctx, p, depth, ignoreMissing, v)
 }
 
-func (b Block) visitAll(p datamodel.Path, depth int, ignoreMissing bool, visitFn func(p datamodel.Path, depth int, b Block)) error {
-	for _, child := range b.Children {
-		blk, err := child.Block()
+func (b Block) visitAll(ctx context.Context, p datamodel.Path, depth int, ignoreMissing bool, v Visitor) error {
+	for ii, child := range b.Children {
+		blk, err := child.BlockContext(ctx)
 		if fatalErr(ignoreMissing, err) {
 			return err
 		} else if err != nil {
+			if err := visitMissing(v, p, depth, b.missingChild(ii)); err != nil {
+				return err
+			}
 			continue
 		}
-		visitFn(p, depth, blk)
-		if err := blk.visitAll(p, depth+1, ignoreMissing, visitFn); err != nil {
+		if err := visit(v, p, depth, blk, func() error {
+			return blk.visitAll(ctx, p, depth+1, ignoreMissing, v)
+		}); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (b Block) visitAllFile(p datamodel.Path, bytes trustlessutils.ByteRange, depth int, ignoreMissing bool, visitFn func(p datamodel.Path, depth int, b Block)) error {
+func (b Block) visitAllFile(ctx context.Context, p datamodel.Path, bytes trustlessutils.ByteRange, depth int, ignoreMissing bool, v Visitor) error {
+	from, to, err := b.resolveRange(bytes)
+	if err != nil {
+		return err
+	}
+
+	var visitFile func(b Block, depth int) error
+	visitFile = func(b Block, depth int) error {
+		if len(b.Children) > 0 && b.DataType != data.Data_File {
+			return errors.New("expected file")
+		}
+		for ii, child := range b.Children {
+			if child.ByteOffset+b.BlockSizes[ii]-1 < from {
+				continue
+			}
+			if child.ByteOffset >= to {
+				continue
+			}
+			blk, err := child.BlockContext(ctx)
+			if fatalErr(ignoreMissing, err) {
+				return err
+			} else if err != nil {
+				if err := visitMissing(v, p, depth, b.missingChild(ii)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := visit(v, p, depth, blk, func() error {
+				return visitFile(blk, depth+1)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visitFile(b, depth)
+}
+
+// resolveRange resolves negative offsets in a byte range against the length of
+// the file, returning the inclusive start and exclusive end.
+func (b Block) resolveRange(bytes trustlessutils.ByteRange) (int64, int64, error) {
 	from := bytes.From
 	var to int64 = math.MaxInt64
 	if bytes.To != nil {
@@ -125,60 +372,79 @@ func (b Block) visitAllFile(p datamodel.Path, bytes trustlessutils.ByteRange, de
 		}
 	}
 	if from > to {
-		br := &trustlessutils.ByteRange{From: from, To: &to}
-		return fmt.Errorf("invalid range (len=%d) %s (orig=%s)", b.Length(), br.String(), bytes.String())
-	}
-
-	var visit func(b Block, depth int) error
-	visit = func(b Block, depth int) error {
-		if len(b.Children) > 0 && b.DataType != data.Data_File {
-			return errors.New("expected file")
-		}
-		for ii, child := range b.Children {
-			if child.ByteOffset+b.BlockSizes[ii]-1 < from {
-				continue
-			}
-			if child.ByteOffset >= to {
-				continue
-			}
-			blk, err := child.Block()
-			if fatalErr(ignoreMissing, err) {
-				return err
-			} else if err != nil {
-				continue
-			}
-			visitFn(p, depth, blk)
-			if err := visit(blk, depth+1); err != nil {
-				return err
-			}
+		return 0, 0, ErrInvalidByteRange{
+			Requested: bytes,
+			Resolved:  trustlessutils.ByteRange{From: from, To: &to},
+			Length:    b.Length(),
 		}
-		return nil
 	}
-	return visit(b, depth)
+	return from, to, nil
 }
 
-func (b Block) visitAllEntity(p datamodel.Path, bytes trustlessutils.ByteRange, depth int, ignoreMissing bool, visitFn func(p datamodel.Path, depth int, b Block)) error {
-	if b.DataType == data.Data_File {
-		return b.visitAllFile(p, bytes, depth, ignoreMissing, visitFn)
+// visitAllEntity visits the blocks that make up the entity rooted at b, as
+// per dag-scope=entity: the blocks of a file within the byte range, or every
+// shard of a HAMT. A plain directory, like any other single-block entity, is
+// just the block itself. The entries of a directory are entities of their own
+// and aren't loaded.
+func (b Block) visitAllEntity(ctx context.Context, p datamodel.Path, bytes trustlessutils.ByteRange, depth int, ignoreMissing bool, v Visitor) error {
+	switch int64(b.DataType) {
+	case data.Data_File:
+		return b.visitAllFile(ctx, p, bytes, depth, ignoreMissing, v)
+	case data.Data_HAMTShard:
+		return b.visitAllShards(ctx, p, depth, ignoreMissing, v)
 	}
+	return nil
+}
 
-	for _, child := range b.Children {
-		blk, err := child.Block()
+// visitAllShards visits the sub-shards of a HAMT, which share its UnixFS path,
+// but not the entries held in them.
+func (b Block) visitAllShards(ctx context.Context, p datamodel.Path, depth int, ignoreMissing bool, v Visitor) error {
+	for ii, child := range b.Children {
+		if child.UnixfsPath.String() != b.UnixfsPath.String() {
+			continue // an entry, not a shard of this entity
+		}
+		blk, err := child.BlockContext(ctx)
 		if fatalErr(ignoreMissing, err) {
 			return err
 		} else if err != nil {
+			if err := visitMissing(v, p, depth, b.missingChild(ii)); err != nil {
+				return err
+			}
 			continue
 		}
-		if blk.UnixfsPath.Last() != p.Last() {
-			continue
+		if err := visit(v, p, depth, blk, func() error {
+			return blk.visitAllShards(ctx, p, depth+1, ignoreMissing, v)
+		}); err != nil {
+			return err
 		}
-		visitFn(p, depth, blk)
-		blk.visitAllEntity(p, bytes, depth+1, ignoreMissing, visitFn)
 	}
 	return nil
 }
 
-func (b Block) findInHamt(p datamodel.Path, depth int, ignoreMissing bool, visitFn func(p datamodel.Path, depth int, b Block)) (Block, int, bool, error) {
+// enterChild enters the child of b linked at the UnixFS path p, if there is
+// one. A child that is missing, and ignored, is visited as missing and
+// returned with DataType_Missing.
+func (b Block) enterChild(ctx context.Context, p datamodel.Path, depth int, ignoreMissing bool, pv *pathVisitor) (Block, bool, error) {
+	for ii, child := range b.Children {
+		if child.UnixfsPath.String() != p.String() {
+			continue
+		}
+		blk, err := child.BlockContext(ctx)
+		if fatalErr(ignoreMissing, err) {
+			return Block{}, false, err
+		} else if err != nil {
+			missing := b.missingChild(ii)
+			return missing, true, visitMissing(pv.Visitor, p, depth, missing)
+		}
+		return blk, true, pv.enter(p, depth, blk)
+	}
+	return Block{}, false, nil
+}
+
+// findInHamt descends the HAMT rooted at b to the entry named by the last
+// segment of p, entering the shards it passes through. A block on the way that
+// is missing, and ignored, is returned in place of the entry with DataType_Missing.
+func (b Block) findInHamt(ctx context.Context, p datamodel.Path, depth int, ignoreMissing bool, pv *pathVisitor) (Block, int, bool, error) {
 	if b.Arity <= 0 {
 		return Block{}, 0, false, errors.New("no fanout (arity) for hamt node")
 	}
@@ -210,14 +476,25 @@ func (b Block) findInHamt(p datamodel.Path, depth int, ignoreMissing bool, visit
 			return Block{}, 0, false, errors.New("bad shard indexing")
 		}
 		child := node.Children[linkIndex]
-		blk, err := child.Block()
+		blk, err := child.BlockContext(ctx)
 		if fatalErr(ignoreMissing, err) {
 			return Block{}, 0, false, err
 		} else if err != nil {
-			return Block{}, depth, false, nil // pretend not found in this hamt
+			missing := node.missingChild(linkIndex)
+			mp := p
+			if missing.UnixfsPath.String() == b.UnixfsPath.String() {
+				// a shard, which is at the path of the directory, like those entered
+				mp = p.Pop()
+			}
+			if err := visitMissing(pv.Visitor, mp, depth, missing); err != nil {
+				return Block{}, 0, false, err
+			}
+			return missing, depth, true, nil
 		}
 		if blk.UnixfsPath.String() == b.UnixfsPath.String() && blk.DataType == data.Data_HAMTShard {
-			visitFn(p.Pop(), depth, blk)
+			if err := pv.enter(p.Pop(), depth, blk); err != nil {
+				return Block{}, 0, false, err
+			}
 			node = blk
 			depth++
 		} else if child.UnixfsPath.Last().String() == key {
@@ -228,6 +505,25 @@ func (b Block) findInHamt(p datamodel.Path, depth int, ignoreMissing bool, visit
 	}
 }
 
+// hamtShardIndex returns the index, in the hex form used in HAMT link names,
+// of the shard at the given level below the root of a HAMT that holds key.
+func hamtShardIndex(key string, arity int64, level int) (string, error) {
+	if arity <= 0 {
+		return "", errors.New("no fanout (arity) for hamt node")
+	}
+	hv := &unixfs.HashBits{Bits: unixfs.Hash([]byte(key))}
+	log2 := bits.TrailingZeros(uint(arity))
+	var childIndex int
+	for ii := 0; ii < level; ii++ {
+		var err error
+		if childIndex, err = hv.Next(log2); err != nil {
+			return "", err
+		}
+	}
+	pfxLen := len(fmt.Sprintf("%X", arity-1))
+	return fmt.Sprintf("%0*X", pfxLen, childIndex), nil
+}
+
 func ParseQuery(spec string) (
 	root cid.Cid,
 	path datamodel.Path,
@@ -244,6 +540,10 @@ func ParseQuery(spec string) (
 		return root, path, scope, duplicates, byteRange, err
 	}
 
+	// defaults, if not overridden by the query string
+	scope = trustlessutils.DagScopeAll
+	duplicates = true
+
 	switch len(specParts) {
 	case 1:
 	case 2:
@@ -251,9 +551,11 @@ func ParseQuery(spec string) (
 		if err != nil {
 			return root, path, scope, duplicates, byteRange, err
 		}
-		scope, err = trustlessutils.ParseDagScope(query.Get("dag-scope"))
-		if err != nil {
-			return root, path, scope, duplicates, byteRange, err
+		if query.Has("dag-scope") {
+			scope, err = trustlessutils.ParseDagScope(query.Get("dag-scope"))
+			if err != nil {
+				return root, path, scope, duplicates, byteRange, err
+			}
 		}
 		duplicates = query.Get("dups") != "n"
 		if query.Get("entity-bytes") != "" {
@@ -274,7 +576,7 @@ func fatalErr(ignoreMissing bool, err error) bool {
 	if err == nil {
 		return false
 	}
-	if nf, ok := err.(interface{ NotFound() bool }); ok && nf.NotFound() {
+	if isNotFound(err) {
 		return !ignoreMissing
 	}
 	return true
@@ -0,0 +1,77 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// TraversalOrder is an order in which the blocks of a DAG may be laid out in a
+// CAR.
+type TraversalOrder string
+
+const (
+	// OrderDFS is depth-first, the order in which Navigate visits blocks, and
+	// the order a trustless gateway responds with.
+	OrderDFS TraversalOrder = "dfs"
+	// OrderBFS is breadth-first, each level of the DAG in turn, left to right.
+	OrderBFS TraversalOrder = "bfs"
+)
+
+// ErrBlockOrder describes the first block of a CAR that isn't where the
+// traversal order expects it to be.
+type ErrBlockOrder struct {
+	Order    TraversalOrder
+	Index    int
+	Expected cid.Cid        // cid.Undef if the CAR has a block after all of those expected
+	Actual   cid.Cid        // cid.Undef if the CAR ends before all of the expected blocks
+	Path     datamodel.Path // UnixFS path of the expected block, or the last expected block if Expected is cid.Undef
+}
+
+func (e ErrBlockOrder) Error() string {
+	m := blockMismatch{Index: e.Index, Expected: e.Expected, Actual: e.Actual, Path: e.Path}
+	return m.message(string(e.Order) + " order")
+}
+
+type orderedBlock struct {
+	blk   Block
+	depth int
+}
+
+// CheckOrder checks that the given CIDs, such as those of the blocks of a CAR
+// in the order they appear in the file, are laid out in the given traversal
+// order of the full DAG rooted at b. A block that is linked to more than once
+// must appear where it is first reached, and may or may not be repeated where
+// it is reached again. Blocks that can't be loaded from the LinkSystem are
+// skipped, so partial CARs may be checked. An ErrBlockOrder is returned for the
+// first block out of order, including any block not reachable from b.
+func (b Block) CheckOrder(ctx context.Context, cids []cid.Cid, order TraversalOrder) error {
+	ordered := make([]orderedBlock, 0)
+	if err := b.NavigateContext(ctx, datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, true, func(p datamodel.Path, depth int, blk Block) {
+		// only what's needed to compare and describe it, not the decoded node
+		ordered = append(ordered, orderedBlock{Block{Cid: blk.Cid, UnixfsPath: blk.UnixfsPath}, depth})
+	}); err != nil {
+		return err
+	}
+	switch order {
+	case OrderDFS:
+	case OrderBFS:
+		// the blocks at each depth are already in left to right order
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].depth < ordered[j].depth })
+	default:
+		return fmt.Errorf("unknown traversal order: %s", order)
+	}
+
+	expected := make([]Block, len(ordered))
+	for ii, o := range ordered {
+		expected[ii] = o.blk
+	}
+	if m := firstMismatch(expected, cids, true); m != nil {
+		return ErrBlockOrder{Order: order, Index: m.Index, Expected: m.Expected, Actual: m.Actual, Path: m.Path}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package block
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestCheckOrder(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	dfs := make([]cid.Cid, 0)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b Block) {
+		dfs = append(dfs, b.Cid)
+	}))
+	require.Len(t, dfs, 6)
+	root, a, chunk, lastChunk, b := dfs[0], dfs[1], dfs[2], dfs[4], dfs[5]
+	require.Equal(t, chunk, dfs[3]) // the first two chunks of "a" are identical
+	other, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		cids     []cid.Cid
+		order    TraversalOrder
+		expected error
+	}{
+		{"dfs", dfs, OrderDFS, nil},
+		{"dfs, no dups", []cid.Cid{root, a, chunk, lastChunk, b}, OrderDFS, nil},
+		{"bfs", []cid.Cid{root, a, b, chunk, chunk, lastChunk}, OrderBFS, nil},
+		{"bfs, no dups", []cid.Cid{root, a, b, chunk, lastChunk}, OrderBFS, nil},
+		{"dfs as bfs", dfs, OrderBFS, ErrBlockOrder{Order: OrderBFS, Index: 2, Expected: b, Actual: chunk, Path: datamodel.ParsePath("b")}},
+		{"swapped", []cid.Cid{root, a, lastChunk, chunk, b}, OrderDFS, ErrBlockOrder{Order: OrderDFS, Index: 2, Expected: chunk, Actual: lastChunk, Path: datamodel.ParsePath("a")}},
+		{"truncated", dfs[:5], OrderDFS, ErrBlockOrder{Order: OrderDFS, Index: 5, Expected: b, Path: datamodel.ParsePath("b")}},
+		{"unreachable", append(dfs[:6:6], other), OrderDFS, ErrBlockOrder{Order: OrderDFS, Index: 6, Actual: other, Path: datamodel.ParsePath("b")}},
+		{"misplaced duplicate", []cid.Cid{root, a, chunk, lastChunk, chunk, b}, OrderDFS, ErrBlockOrder{Order: OrderDFS, Index: 4, Expected: b, Actual: chunk, Path: datamodel.ParsePath("b")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := blk.CheckOrder(context.Background(), tc.cids, tc.order)
+			if tc.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.Equal(t, tc.expected, err)
+			}
+		})
+	}
+
+	require.EqualError(t, blk.CheckOrder(context.Background(), dfs, "random"), "unknown traversal order: random")
+}
@@ -0,0 +1,86 @@
+package block
+
+import (
+	"context"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// Reachable walks the full DAG rooted at b and returns the set of distinct
+// blocks visited. Missing blocks are skipped rather than treated as an error,
+// and are not included.
+func (b Block) Reachable(ctx context.Context) (map[cid.Cid]struct{}, error) {
+	reachable := make(map[cid.Cid]struct{})
+	err := b.NavigateContext(ctx, datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, true, func(p datamodel.Path, depth int, blk Block) {
+		reachable[blk.Cid] = struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reachable, nil
+}
+
+// Orphans returns those of the given CIDs, such as all of the blocks in a CAR,
+// that aren't in the reachable set returned by Reachable, in the order given.
+// Each is loaded from the same LinkSystem as b so that it can be described.
+// Blocks that can't be loaded or decoded, which are often the junk being
+// looked for, are still returned, with DataType_Invalid.
+func (b Block) Orphans(ctx context.Context, reachable map[cid.Cid]struct{}, cids []cid.Cid) ([]Block, error) {
+	orphans := make([]Block, 0)
+	for _, c := range unreachable(reachable, cids) {
+		orphan, err := NewBlockContext(ctx, b.ls, c)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		} else if err != nil {
+			orphan = Block{ls: b.ls, Cid: c, DataType: DataType_Invalid}
+		}
+		orphans = append(orphans, orphan)
+	}
+	return orphans, nil
+}
+
+// PruneCAR writes a CARv1 to w, rooted at b, containing those of the given
+// CIDs that are in the reachable set returned by Reachable, in the order
+// given, so a CAR can be rewritten without the unreachable blocks it carries
+// while otherwise keeping its layout. Each block is written once. The CIDs
+// that were dropped are returned.
+func (b Block) PruneCAR(ctx context.Context, w io.Writer, reachable map[cid.Cid]struct{}, cids []cid.Cid) ([]cid.Cid, error) {
+	// hide any io.WriterAt so that the CAR is always streamed in order, which
+	// also allows w to be a pipe
+	car, err := carstorage.NewWritable(struct{ io.Writer }{w}, []cid.Cid{b.Cid}, carv2.WriteAsCarV1(true), carv2.AllowDuplicatePuts(false), carv2.UseWholeCIDs(true))
+	if err != nil {
+		return nil, err
+	}
+	pruned := make([]cid.Cid, 0)
+	for _, c := range cids {
+		if _, ok := reachable[c]; !ok {
+			pruned = append(pruned, c)
+			continue
+		}
+		byts, err := b.ls.LoadRaw(linking.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c})
+		if err != nil {
+			return nil, err
+		}
+		if err := car.Put(ctx, c.KeyString(), byts); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, nil
+}
+
+func unreachable(reachable map[cid.Cid]struct{}, cids []cid.Cid) []cid.Cid {
+	unreachable := make([]cid.Cid, 0)
+	for _, c := range cids {
+		if _, ok := reachable[c]; !ok {
+			unreachable = append(unreachable, c)
+		}
+	}
+	return unreachable
+}
@@ -0,0 +1,116 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipfs/go-unixfsnode/data"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/multiformats/go-multihash"
+	"github.com/test-go/testify/require"
+)
+
+// putBlock writes the bytes of a block with the given codec to the store
+// behind lsys, whether or not they decode.
+func putBlock(t *testing.T, lsys linking.LinkSystem, codec uint64, byts []byte) cid.Cid {
+	c, err := cid.V1Builder{Codec: codec, MhType: multihash.SHA2_256}.Sum(byts)
+	require.NoError(t, err)
+	w, commit, err := lsys.StorageWriteOpener(linking.LinkContext{})
+	require.NoError(t, err)
+	_, err = w.Write(byts)
+	require.NoError(t, err)
+	require.NoError(t, commit(cidlink.Link{Cid: c}))
+	return c
+}
+
+func TestOrphans(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	// a second DAG in the same store, as with a merged CAR
+	junkEntity, err := generator.Parse(`file:300kB`)
+	require.NoError(t, err)
+	junkEnt, err := junkEntity.Generate(lsys, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	junk, err := NewBlock(lsys, junkEnt.Root)
+	require.NoError(t, err)
+	require.Len(t, junk.Children, 2)
+
+	reachable := make([]cid.Cid, 0)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b Block) {
+		reachable = append(reachable, b.Cid)
+	}))
+	require.Len(t, reachable, 6) // including the duplicate chunk of "a"
+
+	// junk interleaved with the reachable blocks
+	cids := append([]cid.Cid{junk.Cid}, reachable[:3]...)
+	cids = append(cids, junk.Children[0].Cid)
+	cids = append(cids, reachable[3:]...)
+	cids = append(cids, junk.Children[1].Cid)
+
+	// and blocks that can't be decoded: a corrupt dag-pb block, and one in a
+	// codec with no decoder
+	corrupt := putBlock(t, lsys, cid.DagProtobuf, []byte{0xff, 0xff, 0xff})
+	unknown := putBlock(t, lsys, 0x300000, []byte("junk"))
+	cids = append(cids, corrupt, unknown)
+
+	all, err := blk.Reachable(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+
+	orphans, err := blk.Orphans(context.Background(), all, cids)
+	require.NoError(t, err)
+	require.Len(t, orphans, 5)
+	require.Equal(t, junk.Cid, orphans[0].Cid)
+	require.Equal(t, data.Data_File, orphans[0].DataType)
+	require.Equal(t, junk.Children[0].Cid, orphans[1].Cid)
+	require.Equal(t, DataType_RawLeaf, orphans[1].DataType)
+	require.Equal(t, junk.Children[1].Cid, orphans[2].Cid)
+	require.Equal(t, corrupt, orphans[3].Cid)
+	require.Equal(t, DataType_Invalid, orphans[3].DataType)
+	require.Equal(t, "Invalid", orphans[3].DataTypeString())
+	require.Equal(t, unknown, orphans[4].Cid)
+	require.Equal(t, DataType_Invalid, orphans[4].DataType)
+
+	var buf bytes.Buffer
+	pruned, err := blk.PruneCAR(context.Background(), &buf, all, cids)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{junk.Cid, junk.Children[0].Cid, junk.Children[1].Cid, corrupt, unknown}, pruned)
+
+	cr, err := carv2.NewBlockReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{rootEnt.Root}, cr.Roots)
+	actual := make([]cid.Cid, 0)
+	for {
+		b, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		actual = append(actual, b.Cid())
+	}
+	// original order, with the duplicate chunk written once
+	require.Equal(t, append(reachable[:3:3], reachable[4:]...), actual)
+}
@@ -13,10 +13,26 @@ import (
 )
 
 func WritingVisitor(w io.Writer, duplicates, fullPath bool) func(p datamodel.Path, depth int, blk Block) {
+	return writingVisitor(w, duplicates, fullPath, func(blk Block) datamodel.Path { return blk.UnixfsPath })
+}
+
+// IpldWritingVisitor is the same as WritingVisitor but prints the raw IPLD
+// data model path of each block rather than its UnixFS path, for use with
+// NavigateIpld.
+func IpldWritingVisitor(w io.Writer, duplicates, fullPath bool) func(p datamodel.Path, depth int, blk Block) {
+	return writingVisitor(w, duplicates, fullPath, func(blk Block) datamodel.Path { return blk.IpldPath })
+}
+
+func writingVisitor(w io.Writer, duplicates, fullPath bool, pathFn func(Block) datamodel.Path) func(p datamodel.Path, depth int, blk Block) {
 	var lastDepth int
 	seen := make(map[cid.Cid]struct{}, 0)
 
 	return func(p datamodel.Path, depth int, blk Block) {
+		if depth == 0 {
+			// the root of a new walk, such as for the next root of a CAR, in
+			// which duplicates are judged afresh
+			seen = make(map[cid.Cid]struct{})
+		}
 		if _, ok := seen[blk.Cid]; !duplicates && ok {
 			return
 		}
@@ -28,9 +44,9 @@ func WritingVisitor(w io.Writer, duplicates, fullPath bool) func(p datamodel.Pat
 		}
 		fo := ""
 		if fullPath {
-			fo = fmt.Sprintf("/%s", blk.UnixfsPath.String())
+			fo = fmt.Sprintf("/%s", pathFn(blk).String())
 		} else {
-			fo = fmt.Sprintf("/%s", blk.UnixfsPath.Last().String())
+			fo = fmt.Sprintf("/%s", pathFn(blk).Last().String())
 		}
 		if blk.ByteSize > 0 {
 			fo += fmt.Sprintf(" [%d:%d] (%s B)", blk.ByteOffset, blk.ByteOffset+blk.ByteSize-1, humanize.Comma(blk.ByteSize))
@@ -0,0 +1,145 @@
+package block
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/multiformats/go-multicodec"
+)
+
+// Record is a flat, structured description of a visited block, suitable for
+// encoding as JSON or CSV. Root is the root of the walk that visited it, to
+// distinguish the walks of a CAR with several roots.
+type Record struct {
+	Root       string `json:"root"`
+	Cid        string `json:"cid"`
+	Codec      string `json:"codec"`
+	DataType   string `json:"dataType"`
+	UnixfsPath string `json:"unixfsPath"`
+	IpldPath   string `json:"ipldPath"`
+	Depth      int    `json:"depth"`
+	ByteOffset int64  `json:"byteOffset"`
+	ByteSize   int64  `json:"byteSize"`
+	ShardIndex string `json:"shardIndex"`
+	Duplicate  bool   `json:"duplicate"`
+}
+
+var recordCsvHeader = []string{"root", "cid", "codec", "dataType", "unixfsPath", "ipldPath", "depth", "byteOffset", "byteSize", "shardIndex", "duplicate"}
+
+func NewRecord(depth int, blk Block, duplicate bool) Record {
+	return Record{
+		Cid:        blk.Cid.String(),
+		Codec:      multicodec.Code(blk.Cid.Prefix().Codec).String(),
+		DataType:   blk.DataTypeString(),
+		UnixfsPath: "/" + blk.UnixfsPath.String(),
+		IpldPath:   "/" + blk.IpldPath.String(),
+		Depth:      depth,
+		ByteOffset: blk.ByteOffset,
+		ByteSize:   blk.ByteSize,
+		ShardIndex: blk.ShardIndex,
+		Duplicate:  duplicate,
+	}
+}
+
+func (r Record) csv() []string {
+	return []string{
+		r.Root,
+		r.Cid,
+		r.Codec,
+		r.DataType,
+		r.UnixfsPath,
+		r.IpldPath,
+		strconv.Itoa(r.Depth),
+		strconv.FormatInt(r.ByteOffset, 10),
+		strconv.FormatInt(r.ByteSize, 10),
+		r.ShardIndex,
+		strconv.FormatBool(r.Duplicate),
+	}
+}
+
+// RecordVisitor calls recordFn with a Record for each visited block. Blocks
+// that have already been visited are flagged as duplicates, or are skipped
+// entirely if duplicates is false. The visitor may be used for several walks,
+// such as one for each root of a CAR; each starts afresh at its root, so
+// duplicates are only those within the same walk.
+func RecordVisitor(duplicates bool, recordFn func(Record)) func(p datamodel.Path, depth int, blk Block) {
+	rw := newRecordWriter(duplicates, func(r Record) error {
+		recordFn(r)
+		return nil
+	})
+	return func(p datamodel.Path, depth int, blk Block) {
+		rw.Enter(p, depth, blk)
+	}
+}
+
+// NdjsonVisitor writes a JSON Record for each visited block, one per line. An
+// error writing a Record aborts the traversal.
+func NdjsonVisitor(w io.Writer, duplicates bool) Visitor {
+	enc := json.NewEncoder(w)
+	return newRecordWriter(duplicates, func(r Record) error {
+		return enc.Encode(r)
+	})
+}
+
+// CsvVisitor writes a header row, then a CSV Record for each visited block.
+// An error writing a Record aborts the traversal.
+func CsvVisitor(w io.Writer, duplicates bool) (Visitor, error) {
+	cw := csv.NewWriter(w)
+	if err := writeCsvRow(cw, recordCsvHeader); err != nil {
+		return nil, err
+	}
+	return newRecordWriter(duplicates, func(r Record) error {
+		return writeCsvRow(cw, r.csv())
+	}), nil
+}
+
+// writeCsvRow writes and flushes a single row, so that each is written as its
+// block is visited.
+func writeCsvRow(cw *csv.Writer, row []string) error {
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// recordWriter passes a Record for each block entered to recordFn,
+// flagging or skipping duplicates, and aborts the traversal if it fails.
+type recordWriter struct {
+	duplicates bool
+	root       cid.Cid // of the current walk
+	seen       map[cid.Cid]struct{}
+	recordFn   func(Record) error
+}
+
+func newRecordWriter(duplicates bool, recordFn func(Record) error) *recordWriter {
+	return &recordWriter{
+		duplicates: duplicates,
+		seen:       make(map[cid.Cid]struct{}),
+		recordFn:   recordFn,
+	}
+}
+
+func (rw *recordWriter) Enter(p datamodel.Path, depth int, blk Block) error {
+	if depth == 0 {
+		// the root of a new walk
+		rw.root = blk.Cid
+		rw.seen = make(map[cid.Cid]struct{})
+	}
+	_, dup := rw.seen[blk.Cid]
+	if !rw.duplicates && dup {
+		return nil
+	}
+	rw.seen[blk.Cid] = struct{}{}
+	r := NewRecord(depth, blk, dup)
+	r.Root = rw.root.String()
+	return rw.recordFn(r)
+}
+
+func (rw *recordWriter) Leave(p datamodel.Path, depth int, blk Block) error {
+	return nil
+}
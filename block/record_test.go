@@ -0,0 +1,88 @@
+package block
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestRecordVisitor(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`file:600kB{zero}`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	for _, duplicates := range []bool{true, false} {
+		records := make([]Record, 0)
+		visitor := RecordVisitor(duplicates, func(r Record) { records = append(records, r) })
+		require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, visitor))
+		if duplicates {
+			require.Len(t, records, 4)
+			require.Equal(t, []bool{false, false, true, false}, []bool{records[0].Duplicate, records[1].Duplicate, records[2].Duplicate, records[3].Duplicate})
+			require.Equal(t, int64(256144), records[2].ByteOffset)
+			require.Equal(t, "/Links/1/Hash", records[2].IpldPath)
+		} else {
+			require.Len(t, records, 3)
+		}
+		require.Equal(t, "dag-pb", records[0].Codec)
+		require.Equal(t, "File", records[0].DataType)
+		require.Equal(t, "raw", records[1].Codec)
+	}
+
+	var buf bytes.Buffer
+	csvVisitor, err := CsvVisitor(&buf, true)
+	require.NoError(t, err)
+	require.NoError(t, blk.Walk(datamodel.Path{}, trustlessutils.DagScopeBlock, trustlessutils.ByteRange{}, false, csvVisitor))
+	require.Equal(t, "root,cid,codec,dataType,unixfsPath,ipldPath,depth,byteOffset,byteSize,shardIndex,duplicate\n"+
+		blk.Cid.String()+","+blk.Cid.String()+",dag-pb,File,/,/,0,0,600000,,false\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, blk.Walk(datamodel.Path{}, trustlessutils.DagScopeBlock, trustlessutils.ByteRange{}, false, NdjsonVisitor(&buf, true)))
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	require.Contains(t, buf.String(), `"dataType":"File"`)
+
+	// write errors abort the walk rather than truncating the output
+	errBoom := fmt.Errorf("boom")
+	w := &failingWriter{after: 1, err: errBoom}
+	csvVisitor, err = CsvVisitor(w, true)
+	require.NoError(t, err)
+	err = blk.Walk(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, csvVisitor)
+	require.Equal(t, errBoom, err)
+	_, err = CsvVisitor(&failingWriter{err: errBoom}, true)
+	require.Equal(t, errBoom, err)
+	err = blk.Walk(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, NdjsonVisitor(&failingWriter{after: 2, err: errBoom}, true))
+	require.Equal(t, errBoom, err)
+}
+
+// failingWriter accepts after writes, then fails with err.
+type failingWriter struct {
+	after int
+	err   error
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if fw.after == 0 {
+		return 0, fw.err
+	}
+	fw.after--
+	return len(p), nil
+}
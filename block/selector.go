@@ -0,0 +1,18 @@
+package block
+
+import (
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// QuerySelector returns the IPLD selector that go-trustless-utils builds for
+// a trustless query of the given path, scope and byte range. Executing this
+// selector from the root of the DAG should load the same blocks, in the same
+// order, as Navigate visits for the same query.
+func QuerySelector(path datamodel.Path, scope trustlessutils.DagScope, byteRange *trustlessutils.ByteRange) datamodel.Node {
+	return trustlessutils.Request{
+		Path:  path.String(),
+		Scope: scope,
+		Bytes: byteRange,
+	}.Selector()
+}
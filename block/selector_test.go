@@ -0,0 +1,82 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestQuerySelector(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{name:"a"},dir{name:"b"}(file:1kB{name:"c"}),dir{name:"s",sharded}(file:1kB{name:"x"},50*file:1kB))`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	i64 := func(i int64) *int64 { return &i }
+	testCases := []struct {
+		name      string
+		path      string
+		scope     trustlessutils.DagScope
+		byteRange *trustlessutils.ByteRange
+		blocks    int
+	}{
+		{"root all", "", trustlessutils.DagScopeAll, nil, 0},
+		{"root entity", "", trustlessutils.DagScopeEntity, nil, 1},
+		{"root block", "", trustlessutils.DagScopeBlock, nil, 1},
+		{"path all", "b", trustlessutils.DagScopeAll, nil, 3},
+		{"path entity", "b/c", trustlessutils.DagScopeEntity, nil, 3},
+		{"path block", "a", trustlessutils.DagScopeBlock, nil, 2},
+		{"sharded path", "s/x", trustlessutils.DagScopeAll, nil, 0},
+		{"byte range", "a", trustlessutils.DagScopeEntity, &trustlessutils.ByteRange{From: 10, To: i64(100)}, 3},
+		{"negative byte range", "a", trustlessutils.DagScopeEntity, &trustlessutils.ByteRange{From: -100}, 3},
+	}
+	seen := make(map[string]string)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := require.New(t)
+			sel := QuerySelector(datamodel.ParsePath(tc.path), tc.scope, tc.byteRange)
+
+			// the selector loads the blocks that navigating the query visits
+			br := trustlessutils.ByteRange{}
+			if tc.byteRange != nil {
+				br = *tc.byteRange
+			}
+			expected := make([]cid.Cid, 0)
+			req.NoError(blk.Navigate(datamodel.ParsePath(tc.path), tc.scope, br, false, func(p datamodel.Path, depth int, b Block) {
+				expected = append(expected, b.Cid)
+			}))
+			if tc.blocks > 0 {
+				req.Len(expected, tc.blocks)
+			}
+			actual, err := SelectorTraversal(context.Background(), lsys, rootEnt.Root, sel)
+			req.NoError(err)
+			req.Equal(expected, actual)
+
+			// each query builds a distinct selector
+			var buf bytes.Buffer
+			req.NoError(dagjson.Encode(sel, &buf))
+			req.NotContains(seen, buf.String(), "same selector as %s", seen[buf.String()])
+			seen[buf.String()] = tc.name
+		})
+	}
+}
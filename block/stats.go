@@ -0,0 +1,205 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/multiformats/go-multicodec"
+)
+
+// Histogram is a distribution of values in power of two buckets; bucket 0
+// holds zeros and bucket n holds values in [2^(n-1), 2^n).
+type Histogram struct {
+	Count   int
+	Total   int64
+	Min     int64
+	Max     int64
+	Buckets []int
+}
+
+func (h *Histogram) Add(v int64) {
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Total += v
+	b := bits.Len64(uint64(v))
+	for len(h.Buckets) <= b {
+		h.Buckets = append(h.Buckets, 0)
+	}
+	h.Buckets[b]++
+}
+
+// Mean is the average of the values, or 0 if there are none.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.Total) / float64(h.Count)
+}
+
+// Write writes the histogram, one line per non-empty bucket, with each line
+// prefixed by indent. If bytes is true, the values are formatted as sizes.
+func (h Histogram) Write(w io.Writer, indent string, bytes bool) {
+	format := func(v int64) string {
+		if bytes {
+			return humanize.Bytes(uint64(v))
+		}
+		return humanize.Comma(v)
+	}
+	fmt.Fprintf(w, "%scount=%s min=%s max=%s mean=%s\n", indent, humanize.Comma(int64(h.Count)), format(h.Min), format(h.Max), format(int64(h.Mean())))
+	for b, n := range h.Buckets {
+		if n == 0 {
+			continue
+		}
+		if b == 0 {
+			fmt.Fprintf(w, "%s  %-22s %s\n", indent, format(0), humanize.Comma(int64(n)))
+			continue
+		}
+		bucket := fmt.Sprintf("[%s, %s)", format(int64(1)<<(b-1)), format(int64(1)<<b))
+		fmt.Fprintf(w, "%s  %-22s %s\n", indent, bucket, humanize.Comma(int64(n)))
+	}
+}
+
+// Stats describes the blocks and entities of a DAG.
+type Stats struct {
+	Blocks       int            // distinct blocks reachable from the root
+	Bytes        int64          // total size of the distinct blocks
+	ByCodec      map[string]int // distinct blocks by codec
+	ByDataType   map[string]int // distinct blocks by UnixFS data type, or codec for non-UnixFS blocks
+	Missing      int            // distinct blocks linked to but not present
+	LeafSizes    Histogram      // content size of file leaf blocks
+	FileSizes    Histogram      // size of files
+	DirFanout    Histogram      // number of entries in directories, including HAMT sharded directories
+	MaxHamtDepth int            // greatest number of levels in a HAMT
+	MaxDepth     int            // greatest depth of a block from the root
+	Duplicates   int            // number of times a block is linked to after the first, not counting links within its subtree
+	DedupBytes   int64          // bytes saved by storing duplicate blocks only once
+
+	reachable map[cid.Cid]struct{}
+}
+
+// Unreachable returns those of the given CIDs that aren't reachable from the
+// root, in the order given.
+func (s Stats) Unreachable(cids []cid.Cid) []cid.Cid {
+	return unreachable(s.reachable, cids)
+}
+
+// CollectStats walks the full DAG rooted at b and collects statistics about
+// its blocks. Missing blocks are counted rather than treated as an error, so
+// partial DAGs may be described.
+func CollectStats(ctx context.Context, b Block) (Stats, error) {
+	sv := &statsVisitor{
+		ctx: ctx,
+		stats: Stats{
+			ByCodec:    make(map[string]int),
+			ByDataType: make(map[string]int),
+			reachable:  make(map[cid.Cid]struct{}),
+		},
+		missing:   make(map[cid.Cid]struct{}),
+		hamts:     make(map[string]int),
+		blockSize: make(map[cid.Cid]int64),
+	}
+	if err := b.WalkContext(ctx, datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, true, sv); err != nil {
+		return Stats{}, err
+	}
+	for _, entries := range sv.hamts {
+		sv.stats.DirFanout.Add(int64(entries))
+	}
+	return sv.stats, nil
+}
+
+type statsVisitor struct {
+	ctx       context.Context
+	stats     Stats
+	missing   map[cid.Cid]struct{}
+	hamts     map[string]int // entries of each HAMT, by path
+	blockSize map[cid.Cid]int64
+	parents   []Block // the blocks above the current one, by depth
+	hamtDepth []int   // the level within a HAMT of each of parents, or 0
+}
+
+func (sv *statsVisitor) Enter(p datamodel.Path, depth int, b Block) error {
+	sv.parents = append(sv.parents[:depth], b)
+	var parent *Block
+	hamtDepth := 0
+	if depth > 0 {
+		parent = &sv.parents[depth-1]
+	}
+	if b.DataType == data.Data_HAMTShard {
+		hamtDepth = 1
+		if parent != nil && parent.DataType == data.Data_HAMTShard && parent.UnixfsPath.String() == b.UnixfsPath.String() {
+			hamtDepth = sv.hamtDepth[depth-1] + 1
+		}
+	}
+	sv.hamtDepth = append(sv.hamtDepth[:depth], hamtDepth)
+
+	if depth > sv.stats.MaxDepth {
+		sv.stats.MaxDepth = depth
+	}
+	if hamtDepth > sv.stats.MaxHamtDepth {
+		sv.stats.MaxHamtDepth = hamtDepth
+	}
+
+	if _, ok := sv.stats.reachable[b.Cid]; ok {
+		sv.stats.Duplicates++
+		sv.stats.DedupBytes += sv.blockSize[b.Cid]
+		// its subtree has already been counted, and is only stored once
+		return SkipChildren
+	}
+	byts, err := b.ls.LoadRaw(linking.LinkContext{Ctx: sv.ctx}, cidlink.Link{Cid: b.Cid})
+	if err != nil {
+		return err
+	}
+	sv.stats.reachable[b.Cid] = struct{}{}
+	sv.blockSize[b.Cid] = int64(len(byts))
+	sv.stats.Blocks++
+	sv.stats.Bytes += int64(len(byts))
+	sv.stats.ByCodec[multicodec.Code(b.Cid.Prefix().Codec).String()]++
+	sv.stats.ByDataType[b.DataTypeString()]++
+
+	switch b.DataType {
+	case data.Data_File, data.Data_Raw, DataType_RawLeaf:
+		if len(b.Children) == 0 {
+			sv.stats.LeafSizes.Add(b.ByteSize)
+		}
+		if parent == nil || parent.UnixfsPath.String() != b.UnixfsPath.String() {
+			sv.stats.FileSizes.Add(b.Length())
+		}
+	case data.Data_Directory:
+		sv.stats.DirFanout.Add(int64(len(b.Children)))
+	case data.Data_HAMTShard:
+		entries := 0
+		for _, child := range b.Children {
+			if child.UnixfsPath.String() != b.UnixfsPath.String() {
+				entries++
+			}
+		}
+		sv.hamts[b.UnixfsPath.String()] += entries
+	}
+	return nil
+}
+
+func (sv *statsVisitor) Leave(p datamodel.Path, depth int, b Block) error {
+	return nil
+}
+
+func (sv *statsVisitor) Missing(p datamodel.Path, depth int, b Block) error {
+	if _, ok := sv.missing[b.Cid]; !ok {
+		sv.missing[b.Cid] = struct{}{}
+		sv.stats.Missing++
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package block
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/test-go/testify/require"
+)
+
+func TestCollectStats(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"},dir{name:"c",sharded}(50*file:1kB))`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	stats, err := CollectStats(context.Background(), blk)
+	require.NoError(t, err)
+
+	shards := stats.ByDataType["HAMTShard"]
+	require.True(t, shards > 1)
+	require.Equal(t, map[string]int{"Directory": 1, "File": 1, "RawLeaf": 2 + 1 + 50, "HAMTShard": shards}, stats.ByDataType)
+	require.Equal(t, map[string]int{"dag-pb": 2 + shards, "raw": 53}, stats.ByCodec)
+	require.Equal(t, 2+53+shards, stats.Blocks)
+	require.Equal(t, 0, stats.Missing)
+
+	// the first two chunks of "a" are identical
+	require.Equal(t, 1, stats.Duplicates)
+	require.Equal(t, int64(256144), stats.DedupBytes)
+
+	require.Equal(t, 52, stats.FileSizes.Count)
+	require.Equal(t, int64(600000+51*1000), stats.FileSizes.Total)
+	require.Equal(t, int64(1000), stats.FileSizes.Min)
+	require.Equal(t, int64(600000), stats.FileSizes.Max)
+	require.Equal(t, 53, stats.LeafSizes.Count)       // distinct leaves
+	require.Equal(t, 51, stats.LeafSizes.Buckets[10]) // [512, 1024)
+
+	require.Equal(t, 2, stats.DirFanout.Count)
+	require.Equal(t, int64(3+50), stats.DirFanout.Total)
+	require.True(t, stats.MaxHamtDepth > 1)
+	require.Equal(t, stats.MaxHamtDepth+1, stats.MaxDepth) // leaves are below the deepest shard
+
+	other, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{other}, stats.Unreachable([]cid.Cid{rootEnt.Root, other}))
+
+	// a subtree linked to twice is counted once, as a single duplicate of its
+	// root, rather than walked again
+	entity, err = generator.Parse(`dir(file:600kB{zero,name:"a"},file:600kB{zero,name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err = entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err = NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	require.Equal(t, blk.Children[0].Cid, blk.Children[1].Cid)
+	file, err := blk.Children[0].Block()
+	require.NoError(t, err)
+	fileBytes, err := lsys.LoadRaw(linking.LinkContext{}, cidlink.Link{Cid: file.Cid})
+	require.NoError(t, err)
+	lastChunk := file.Children[2].Cid
+
+	var loads int
+	sro := lsys.StorageReadOpener
+	lsys.StorageReadOpener = func(lc linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		if lnk.(cidlink.Link).Cid == lastChunk {
+			loads++
+		}
+		return sro(lc, lnk)
+	}
+	blk, err = NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	stats, err = CollectStats(context.Background(), blk)
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.Blocks) // directory, file, zero chunk, last chunk
+	// the second zero chunk of the first file, and the second file
+	require.Equal(t, 2, stats.Duplicates)
+	require.Equal(t, int64(256144+len(fileBytes)), stats.DedupBytes)
+	require.Equal(t, 1, stats.FileSizes.Count)
+	require.Equal(t, 2, stats.LeafSizes.Count)
+	// once by the walk, and once for its size
+	require.Equal(t, 2, loads)
+}
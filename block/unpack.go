@@ -0,0 +1,186 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipld/go-fixtureplate/unixfs"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// Unpack writes the UnixFS entities that Navigate visits for path, with
+// dag-scope=all, to the directory dir, which must already exist. Each entity is
+// written at its UnixFS path below dir, so the directories along the path are
+// created but only hold the entries on the path. A root that is a file or
+// symlink is written to dir under its CID. Modes and modification times are
+// applied where present, other than the times of symlinks. Existing files
+// aren't overwritten, and names that would escape dir are rejected.
+func (b Block) Unpack(ctx context.Context, path datamodel.Path, dir string) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	uv := &unpackingVisitor{ctx: ctx, root: root}
+	if err := b.WalkContext(ctx, path, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, uv); err != nil {
+		if uv.file != nil {
+			uv.file.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// unpackingVisitor writes each entity entered to the filesystem. The chunks of
+// a file are written at their offsets as they are entered, and the file is
+// closed, and its metadata applied, when its root block is left.
+type unpackingVisitor struct {
+	ctx       context.Context
+	root      *os.Root
+	file      *os.File // the file currently being written, if any
+	fileDepth int
+}
+
+func (uv *unpackingVisitor) Enter(p datamodel.Path, depth int, b Block) error {
+	if uv.file != nil {
+		return uv.writeContent(b)
+	}
+	name, err := unpackName(b)
+	if err != nil {
+		return err
+	}
+	switch b.DataType {
+	case data.Data_Directory, data.Data_HAMTShard:
+		// the shards of a HAMT share the path of the directory
+		fi, err := uv.root.Lstat(name)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("cannot unpack directory %s over an existing file", name)
+			}
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		return uv.root.Mkdir(name, 0o755)
+	case data.Data_File, data.Data_Raw, DataType_RawLeaf:
+		f, err := uv.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		uv.file, uv.fileDepth = f, depth
+		return uv.writeContent(b)
+	case data.Data_Symlink:
+		return uv.root.Symlink(b.Target, name)
+	}
+	return ErrUnsupportedDataType{Cid: b.Cid, DataType: b.DataTypeString()}
+}
+
+func (uv *unpackingVisitor) Leave(p datamodel.Path, depth int, b Block) error {
+	if uv.file != nil {
+		if depth > uv.fileDepth {
+			return nil // a chunk
+		}
+		err := uv.file.Close()
+		uv.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if b.DataType == data.Data_Symlink {
+		// the times of a symlink can't be set without following it
+		return nil
+	}
+	name, err := unpackName(b)
+	if err != nil {
+		return err
+	}
+	if b.Mode != nil {
+		if err := uv.root.Chmod(name, fileMode(*b.Mode)); err != nil {
+			return err
+		}
+	}
+	if b.Mtime != nil {
+		if err := uv.root.Chtimes(name, *b.Mtime, *b.Mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeContent writes the bytes held in a file block itself, not those of its
+// children, at its offset in the file being written.
+func (uv *unpackingVisitor) writeContent(b Block) error {
+	var content []byte
+	switch b.DataType {
+	case DataType_RawLeaf:
+		byts, err := b.ls.LoadRaw(linking.LinkContext{Ctx: uv.ctx}, cidlink.Link{Cid: b.Cid})
+		if err != nil {
+			return err
+		}
+		content = byts
+	case data.Data_File, data.Data_Raw:
+		pbNode, err := unixfs.ToPbnode(b.node)
+		if err != nil {
+			return err
+		}
+		ufsData, err := unixfs.ToData(pbNode)
+		if err != nil {
+			return err
+		}
+		if ufsData.FieldData().Exists() {
+			content = ufsData.FieldData().Must().Bytes()
+		}
+	default:
+		return fmt.Errorf("expected file, got %s", b.DataTypeString())
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	_, err := uv.file.WriteAt(content, b.ByteOffset)
+	return err
+}
+
+// unpackName returns the path, relative to the unpack directory, that the
+// entity b is written to.
+func unpackName(b Block) (string, error) {
+	if b.UnixfsPath.Len() == 0 {
+		switch b.DataType {
+		case data.Data_Directory, data.Data_HAMTShard:
+			return ".", nil
+		}
+		return b.Cid.String(), nil
+	}
+	segs := make([]string, 0, b.UnixfsPath.Len())
+	for _, seg := range b.UnixfsPath.Segments() {
+		name := seg.String()
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return "", fmt.Errorf("cannot unpack unsafe name %q in path %s", name, b.UnixfsPath)
+		}
+		segs = append(segs, name)
+	}
+	return filepath.Join(segs...), nil
+}
+
+// fileMode converts a UnixFS mode to an fs.FileMode, which has its own bits for
+// setuid, setgid and sticky.
+func fileMode(mode uint32) fs.FileMode {
+	fm := fs.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		fm |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		fm |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		fm |= fs.ModeSticky
+	}
+	return fm
+}
@@ -0,0 +1,160 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/multiformats/go-multihash"
+	"github.com/test-go/testify/require"
+)
+
+func TestUnpack(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	// a tree on disk, imported and unpacked again
+	src := t.TempDir()
+	content := make([]byte, 600000)
+	rand.New(rand.NewSource(0)).Read(content)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a"), content, 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(src, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "b"), []byte("hello"), 0o644))
+	require.NoError(t, os.Symlink("sub/b", filepath.Join(src, "link")))
+	rootLnk, _, err := builder.BuildUnixFSRecursive(src, &lsys)
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootLnk.(cidlink.Link).Cid)
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	require.NoError(t, blk.Unpack(context.Background(), datamodel.Path{}, out))
+	byts, err := os.ReadFile(filepath.Join(out, "a"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, byts))
+	byts, err = os.ReadFile(filepath.Join(out, "sub", "b"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(byts))
+	target, err := os.Readlink(filepath.Join(out, "link"))
+	require.NoError(t, err)
+	require.Equal(t, "sub/b", target)
+	reLnk, _, err := builder.BuildUnixFSRecursive(out, &lsys)
+	require.NoError(t, err)
+	require.Equal(t, rootLnk, reLnk)
+
+	// existing files aren't overwritten
+	require.Error(t, blk.Unpack(context.Background(), datamodel.Path{}, out))
+
+	// only the entries along the path
+	out = t.TempDir()
+	require.NoError(t, blk.Unpack(context.Background(), datamodel.ParsePath("sub"), out))
+	_, err = os.Stat(filepath.Join(out, "sub", "b"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(out, "a"))
+	require.True(t, os.IsNotExist(err))
+
+	// a root file is named by its CID
+	out = t.TempDir()
+	fileBlk, err := NewBlock(lsys, blk.Children[0].Cid)
+	require.NoError(t, err)
+	require.NoError(t, fileBlk.Unpack(context.Background(), datamodel.Path{}, out))
+	byts, err = os.ReadFile(filepath.Join(out, fileBlk.Cid.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, byts))
+
+	// a HAMT, and a file of identical chunks
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"z"},dir{name:"d",sharded}(20*file:1kB))`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err = NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	out = t.TempDir()
+	require.NoError(t, blk.Unpack(context.Background(), datamodel.Path{}, out))
+	byts, err = os.ReadFile(filepath.Join(out, "z"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(make([]byte, 600000), byts))
+	entries, err := os.ReadDir(filepath.Join(out, "d"))
+	require.NoError(t, err)
+	require.Len(t, entries, 20)
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		require.NoError(t, err)
+		require.Equal(t, int64(1000), fi.Size())
+	}
+
+	// modes and mtimes
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	storeNode := func(fn func(*builder.Builder), links ...dagpb.PBLink) cid.Cid {
+		ufsData, err := builder.BuildUnixFS(fn)
+		require.NoError(t, err)
+		node, err := qp.BuildMap(dagpb.Type.PBNode, 2, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Links", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+				for _, l := range links {
+					qp.ListEntry(la, qp.Node(l))
+				}
+			}))
+			qp.MapEntry(ma, "Data", qp.Bytes(data.EncodeUnixFSData(ufsData)))
+		})
+		require.NoError(t, err)
+		lnk, err := lsys.Store(linking.LinkContext{}, cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: cid.DagProtobuf, MhType: multihash.SHA2_256, MhLength: -1}}, node)
+		require.NoError(t, err)
+		return lnk.(cidlink.Link).Cid
+	}
+	file := storeNode(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_File)
+		builder.Data(b, []byte("secret"))
+		builder.FileSize(b, 6)
+		builder.Permissions(b, 0o600)
+		builder.Mtime(b, func(tb builder.TimeBuilder) { builder.Time(tb, mtime) })
+	})
+	entry, err := builder.BuildUnixFSDirectoryEntry("f", 0, cidlink.Link{Cid: file})
+	require.NoError(t, err)
+	dir := storeNode(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_Directory)
+		builder.Permissions(b, 0o750)
+		builder.Mtime(b, func(tb builder.TimeBuilder) { builder.Seconds(tb, mtime.Unix()) })
+	}, entry)
+	blk, err = NewBlock(lsys, dir)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0o750), *blk.Mode)
+	out = t.TempDir()
+	require.NoError(t, blk.Unpack(context.Background(), datamodel.Path{}, out))
+	fi, err := os.Stat(filepath.Join(out, "f"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode())
+	require.True(t, mtime.Equal(fi.ModTime()))
+	fi, err = os.Stat(out)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o750)|os.ModeDir, fi.Mode())
+	require.True(t, mtime.Truncate(time.Second).Equal(fi.ModTime()))
+	byts, err = os.ReadFile(filepath.Join(out, "f"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(byts))
+
+	// names that would escape the directory
+	entry, err = builder.BuildUnixFSDirectoryEntry("..", 0, cidlink.Link{Cid: file})
+	require.NoError(t, err)
+	dir = storeNode(func(b *builder.Builder) { builder.DataType(b, data.Data_Directory) }, entry)
+	blk, err = NewBlock(lsys, dir)
+	require.NoError(t, err)
+	require.EqualError(t, blk.Unpack(context.Background(), datamodel.Path{}, t.TempDir()), `cannot unpack unsafe name ".." in path ..`)
+}
@@ -0,0 +1,394 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+)
+
+// ErrTraversalMismatch describes the first point at which the blocks visited
+// by Navigate diverge from those loaded by a go-ipld-prime selector traversal
+// of the same query.
+type ErrTraversalMismatch struct {
+	Index    int
+	Navigate cid.Cid // cid.Undef if Navigate visited fewer blocks
+	Selector cid.Cid // cid.Undef if the selector traversal loaded fewer blocks
+}
+
+func (e ErrTraversalMismatch) Error() string {
+	return fmt.Sprintf("traversal mismatch at block %d: navigate=%s, selector=%s", e.Index, cidOrNone(e.Navigate), cidOrNone(e.Selector))
+}
+
+// VerifyTraversal executes the query both with Navigate and with a
+// go-ipld-prime selector traversal, using the selector from QuerySelector,
+// over the same LinkSystem and compares the ordered list of blocks. An
+// ErrTraversalMismatch is returned at the first divergence. If duplicates is
+// false, repeat blocks are removed from both lists before comparison.
+//
+// The LinkSystem this Block was loaded with must have UnixFS reification
+// enabled for the selector traversal to interpret UnixFS data.
+func (b Block) VerifyTraversal(
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+) error {
+	return b.VerifyTraversalContext(context.Background(), path, scope, bytes, duplicates)
+}
+
+// VerifyTraversalContext is the same as VerifyTraversal, but both traversals
+// are stopped if the context is cancelled.
+func (b Block) VerifyTraversalContext(
+	ctx context.Context,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+) error {
+	navigated := make([]cid.Cid, 0)
+	if err := b.NavigateContext(ctx, path, scope, bytes, false, func(p datamodel.Path, depth int, blk Block) {
+		navigated = append(navigated, blk.Cid)
+	}); err != nil {
+		return err
+	}
+	selected, err := SelectorTraversal(ctx, b.ls, b.Cid, QuerySelector(path, scope, &bytes))
+	if err != nil {
+		return err
+	}
+	if !duplicates {
+		navigated = dedupe(navigated)
+		selected = dedupe(selected)
+	}
+	for ii := 0; ii < len(navigated) || ii < len(selected); ii++ {
+		var n, s cid.Cid
+		if ii < len(navigated) {
+			n = navigated[ii]
+		}
+		if ii < len(selected) {
+			s = selected[ii]
+		}
+		if n != s {
+			return ErrTraversalMismatch{Index: ii, Navigate: n, Selector: s}
+		}
+	}
+	return nil
+}
+
+// SelectorTraversal executes a go-ipld-prime selector traversal from the root
+// and returns the CIDs of the blocks loaded, in order. Matched nodes that are
+// UnixFS files have their bytes consumed so that the blocks required for the
+// (possibly ranged) file content are loaded. The traversal is stopped if the
+// context is cancelled.
+func SelectorTraversal(ctx context.Context, ls linking.LinkSystem, root cid.Cid, sel datamodel.Node) ([]cid.Cid, error) {
+	compiled, err := selector.CompileSelector(sel)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make([]cid.Cid, 0)
+	sro := ls.StorageReadOpener
+	ls.StorageReadOpener = func(lc linking.LinkContext, l datamodel.Link) (io.Reader, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r, err := sro(lc, l)
+		if err == nil {
+			loaded = append(loaded, l.(cidlink.Link).Cid)
+		}
+		return r, err
+	}
+	chooser := dagpb.AddSupportToChooser(basicnode.Chooser)
+	lnk := cidlink.Link{Cid: root}
+	lctx := linking.LinkContext{Ctx: ctx}
+	proto, err := chooser(lnk, lctx)
+	if err != nil {
+		return nil, err
+	}
+	node, err := ls.Load(lctx, lnk, proto)
+	if err != nil {
+		return nil, err
+	}
+	prog := traversal.Progress{Cfg: &traversal.Config{
+		Ctx:                            ctx,
+		LinkSystem:                     ls,
+		LinkTargetNodePrototypeChooser: chooser,
+	}}
+	if err := prog.WalkMatching(node, compiled, unixfsnode.BytesConsumingMatcher); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func dedupe(cids []cid.Cid) []cid.Cid {
+	seen := make(map[cid.Cid]struct{}, len(cids))
+	deduped := make([]cid.Cid, 0, len(cids))
+	for _, c := range cids {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		deduped = append(deduped, c)
+	}
+	return deduped
+}
+
+func cidOrNone(c cid.Cid) string {
+	if c == cid.Undef {
+		return "none"
+	}
+	return c.String()
+}
+
+// ErrResponseMismatch describes the first point at which the blocks of a
+// response CAR diverge from those expected for the query.
+type ErrResponseMismatch struct {
+	Index    int
+	Expected cid.Cid        // cid.Undef if the response has more blocks than expected
+	Actual   cid.Cid        // cid.Undef if the response has fewer blocks than expected
+	Path     datamodel.Path // UnixFS path of the expected block, or the last expected block if Expected is cid.Undef
+}
+
+func (e ErrResponseMismatch) Error() string {
+	return blockMismatch(e).message("response")
+}
+
+// blockMismatch describes the first block of a sequence, such as the blocks of
+// a CAR, that isn't the block expected in its place. It is the common form of
+// ErrResponseMismatch and ErrBlockOrder.
+type blockMismatch struct {
+	Index    int
+	Expected cid.Cid        // cid.Undef if the sequence has a block after all of those expected
+	Actual   cid.Cid        // cid.Undef if the sequence ends before all of the expected blocks
+	Path     datamodel.Path // UnixFS path of the expected block, or the last matched block if Expected is cid.Undef
+}
+
+func (m blockMismatch) message(what string) string {
+	if m.Expected == cid.Undef {
+		return fmt.Sprintf("%s mismatch at block %d (after /%s): unexpected block %s", what, m.Index, m.Path.String(), m.Actual.String())
+	}
+	return fmt.Sprintf("%s mismatch at block %d (/%s): expected=%s, got=%s", what, m.Index, m.Path.String(), m.Expected.String(), cidOrNone(m.Actual))
+}
+
+// firstMismatch compares the actual CIDs against the expected blocks, in
+// order, and returns the first that differs, or nil if they match. If
+// omitDuplicates is true, a repeat of an expected block that has already been
+// matched may be left out of actual.
+func firstMismatch(expected []Block, actual []cid.Cid, omitDuplicates bool) *blockMismatch {
+	seen := make(map[cid.Cid]struct{}, len(expected))
+	var ii int
+	var last datamodel.Path
+	for _, e := range expected {
+		if ii < len(actual) && actual[ii] == e.Cid {
+			seen[e.Cid] = struct{}{}
+			last = e.UnixfsPath
+			ii++
+			continue
+		}
+		if _, ok := seen[e.Cid]; ok && omitDuplicates {
+			continue
+		}
+		m := &blockMismatch{Index: ii, Expected: e.Cid, Path: e.UnixfsPath}
+		if ii < len(actual) {
+			m.Actual = actual[ii]
+		}
+		return m
+	}
+	if ii < len(actual) {
+		return &blockMismatch{Index: ii, Actual: actual[ii], Path: last}
+	}
+	return nil
+}
+
+// ErrResponseRoots is returned when the roots in the header of a response CAR
+// aren't just the root of the query.
+type ErrResponseRoots struct {
+	Expected cid.Cid
+	Actual   []cid.Cid
+}
+
+func (e ErrResponseRoots) Error() string {
+	return fmt.Sprintf("response has unexpected roots: expected=[%s], got=%v", e.Expected.String(), e.Actual)
+}
+
+// ErrResponseBlockHash is returned when the data of a block in a response CAR
+// doesn't hash to its CID.
+type ErrResponseBlockHash struct {
+	Index int
+	Cid   cid.Cid
+}
+
+func (e ErrResponseBlockHash) Error() string {
+	return fmt.Sprintf("response block %d has data that doesn't match its CID %s", e.Index, e.Cid.String())
+}
+
+// VerifyResponse checks a response CAR, such as the body of a trustless
+// gateway response, for the query from the DAG rooted at b. The response must
+// have b as its only root, and contain exactly the blocks that Navigate visits,
+// in order, with valid hashes. If duplicates is false, repeat blocks must be
+// omitted from the response. An ErrResponseMismatch, ErrResponseRoots or
+// ErrResponseBlockHash is returned for the first problem found. The DAG at b
+// must be complete for the query, a block missing from it is returned as a
+// wrapped ErrMissingBlock.
+func (b Block) VerifyResponse(
+	ctx context.Context,
+	response io.Reader,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+) error {
+	blocks, err := readResponse(response, b.Cid)
+	if err != nil {
+		return err
+	}
+	return b.verifyResponse(ctx, blocks, path, scope, bytes, duplicates, false)
+}
+
+// VerifyResponse is the same as Block#VerifyResponse, but without a copy of
+// the DAG to check against; the query is navigated over the blocks in the
+// response itself, so a block required by the query that the response lacks is
+// reported as a mismatch at the point it was expected.
+func VerifyResponse(
+	ctx context.Context,
+	response io.Reader,
+	root cid.Cid,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+) error {
+	blocks, err := readResponse(response, root)
+	if err != nil {
+		return err
+	}
+	store := make(responseStorage, len(blocks))
+	for _, blk := range blocks {
+		store[blk.cid.KeyString()] = blk.data
+	}
+	ls := cidlink.DefaultLinkSystem()
+	ls.TrustedStorage = true
+	ls.SetReadStorage(store)
+	unixfsnode.AddUnixFSReificationToLinkSystem(&ls)
+	rootBlk, err := NewBlockContext(ctx, ls, root)
+	if isNotFound(err) {
+		return ErrResponseMismatch{Expected: root, Actual: firstCid(blocks)}
+	} else if err != nil {
+		return err
+	}
+	return rootBlk.verifyResponse(ctx, blocks, path, scope, bytes, duplicates, true)
+}
+
+type responseBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// readResponse reads the blocks of a response CAR, checking its roots and the
+// hash of each block.
+func readResponse(response io.Reader, root cid.Cid) ([]responseBlock, error) {
+	// hashes are checked here rather than by the reader, to report the index
+	cr, err := carv2.NewBlockReader(response, carv2.WithTrustedCAR(true))
+	if err != nil {
+		return nil, err
+	}
+	if len(cr.Roots) != 1 || cr.Roots[0] != root {
+		return nil, ErrResponseRoots{Expected: root, Actual: cr.Roots}
+	}
+	blocks := make([]responseBlock, 0)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return blocks, nil
+		} else if err != nil {
+			return nil, err
+		}
+		c, err := blk.Cid().Prefix().Sum(blk.RawData())
+		if err != nil {
+			return nil, err
+		}
+		if !c.Equals(blk.Cid()) {
+			return nil, ErrResponseBlockHash{Index: len(blocks), Cid: blk.Cid()}
+		}
+		blocks = append(blocks, responseBlock{blk.Cid(), blk.RawData()})
+	}
+}
+
+func (b Block) verifyResponse(
+	ctx context.Context,
+	blocks []responseBlock,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	bytes trustlessutils.ByteRange,
+	duplicates bool,
+	fromResponse bool,
+) error {
+	expected := make([]Block, 0)
+	seen := make(map[cid.Cid]struct{})
+	err := b.NavigateContext(ctx, path, scope, bytes, false, func(p datamodel.Path, depth int, blk Block) {
+		if _, ok := seen[blk.Cid]; ok && !duplicates {
+			return
+		}
+		seen[blk.Cid] = struct{}{}
+		expected = append(expected, blk)
+	})
+	var missing ErrMissingBlock
+	if errors.As(err, &missing) {
+		if !fromResponse {
+			// the source should hold the whole DAG, without it the expected
+			// blocks aren't known
+			return fmt.Errorf("source DAG is incomplete: %w", err)
+		}
+		// the traversal of the response can't go any further, so the missing
+		// block is the last that can be expected
+		expected = append(expected, Block{Cid: missing.Cid, UnixfsPath: missing.Path})
+	} else if err != nil {
+		return err
+	}
+
+	actual := make([]cid.Cid, len(blocks))
+	for ii, blk := range blocks {
+		actual[ii] = blk.cid
+	}
+	if m := firstMismatch(expected, actual, false); m != nil {
+		return ErrResponseMismatch(*m)
+	}
+	return nil
+}
+
+func firstCid(blocks []responseBlock) cid.Cid {
+	if len(blocks) == 0 {
+		return cid.Undef
+	}
+	return blocks[0].cid
+}
+
+// responseStorage is a read-only store of the blocks of a response, which
+// reports absent blocks with the NotFound error used by CAR storage.
+type responseStorage map[string][]byte
+
+func (s responseStorage) Has(ctx context.Context, key string) (bool, error) {
+	_, ok := s[key]
+	return ok, nil
+}
+
+func (s responseStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	data, ok := s[key]
+	if !ok {
+		c, _ := cid.Cast([]byte(key))
+		return nil, carstorage.ErrNotFound{Cid: c}
+	}
+	return data, nil
+}
@@ -0,0 +1,119 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestVerifyResponse(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	// Directory, File a, RawLeaf a (x2, identical), RawLeaf a, RawLeaf b
+	all := make([]cid.Cid, 0)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b Block) {
+		all = append(all, b.Cid)
+	}))
+	require.Len(t, all, 6)
+	require.Equal(t, all[2], all[3])
+
+	writeCar := func(roots []cid.Cid, cids []cid.Cid, corrupt int) io.Reader {
+		var buf bytes.Buffer
+		car, err := carstorage.NewWritable(struct{ io.Writer }{&buf}, roots, carv2.WriteAsCarV1(true), carv2.AllowDuplicatePuts(true), carv2.UseWholeCIDs(true))
+		require.NoError(t, err)
+		for ii, c := range cids {
+			byts, err := lsys.LoadRaw(linking.LinkContext{}, cidlink.Link{Cid: c})
+			require.NoError(t, err)
+			if ii == corrupt {
+				byts = append([]byte{}, byts...)
+				byts[0] ^= 0xff
+			}
+			require.NoError(t, car.Put(context.Background(), c.KeyString(), byts))
+		}
+		return &buf
+	}
+	roots := []cid.Cid{rootEnt.Root}
+	without := func(cids []cid.Cid, ii int) []cid.Cid {
+		return append(append([]cid.Cid{}, cids[:ii]...), cids[ii+1:]...)
+	}
+	swapped := append([]cid.Cid{}, all...)
+	swapped[4], swapped[5] = swapped[5], swapped[4]
+
+	testCases := []struct {
+		name       string
+		path       string
+		scope      trustlessutils.DagScope
+		duplicates bool
+		roots      []cid.Cid
+		cids       []cid.Cid
+		corrupt    int
+		expected   error
+	}{
+		{"all", "", trustlessutils.DagScopeAll, true, roots, all, -1, nil},
+		{"all, no dups", "", trustlessutils.DagScopeAll, false, roots, without(all, 3), -1, nil},
+		{"dups when not expected", "", trustlessutils.DagScopeAll, false, roots, all, -1, ErrResponseMismatch{Index: 3, Expected: all[4], Actual: all[3], Path: datamodel.ParsePath("a")}},
+		{"no dups when expected", "", trustlessutils.DagScopeAll, true, roots, without(all, 3), -1, ErrResponseMismatch{Index: 3, Expected: all[3], Actual: all[4], Path: datamodel.ParsePath("a")}},
+		{"out of order", "", trustlessutils.DagScopeAll, true, roots, swapped, -1, ErrResponseMismatch{Index: 4, Expected: all[4], Actual: all[5], Path: datamodel.ParsePath("a")}},
+		{"missing", "", trustlessutils.DagScopeAll, true, roots, all[:5], -1, ErrResponseMismatch{Index: 5, Expected: all[5], Path: datamodel.ParsePath("b")}},
+		{"extra", "b", trustlessutils.DagScopeAll, true, roots, append([]cid.Cid{all[0], all[5]}, all[1]), -1, ErrResponseMismatch{Index: 2, Actual: all[1], Path: datamodel.ParsePath("b")}},
+		{"path", "b", trustlessutils.DagScopeAll, true, roots, []cid.Cid{all[0], all[5]}, -1, nil},
+		{"bad roots", "", trustlessutils.DagScopeAll, true, []cid.Cid{all[1]}, all, -1, ErrResponseRoots{Expected: rootEnt.Root, Actual: []cid.Cid{all[1]}}},
+		{"bad hash", "", trustlessutils.DagScopeAll, true, roots, all, 5, ErrResponseBlockHash{Index: 5, Cid: all[5]}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("source", func(t *testing.T) {
+				err := blk.VerifyResponse(context.Background(), writeCar(tc.roots, tc.cids, tc.corrupt), datamodel.ParsePath(tc.path), tc.scope, trustlessutils.ByteRange{}, tc.duplicates)
+				require.Equal(t, tc.expected, err)
+			})
+			t.Run("self", func(t *testing.T) {
+				err := VerifyResponse(context.Background(), writeCar(tc.roots, tc.cids, tc.corrupt), rootEnt.Root, datamodel.ParsePath(tc.path), tc.scope, trustlessutils.ByteRange{}, tc.duplicates)
+				require.Equal(t, tc.expected, err)
+			})
+		})
+	}
+
+	// a source missing a block can't say what the response should be, even
+	// when the response stops where the source does
+	sro := lsys.StorageReadOpener
+	lsys.StorageReadOpener = func(lc linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		if lnk.(cidlink.Link).Cid == all[5] {
+			return nil, carstorage.ErrNotFound{Cid: all[5]}
+		}
+		return sro(lc, lnk)
+	}
+	partial, err := NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+	err = partial.VerifyResponse(context.Background(), writeCar(roots, all[:5], -1), datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, true)
+	var mb ErrMissingBlock
+	require.True(t, errors.As(err, &mb))
+	require.Equal(t, all[5], mb.Cid)
+	require.Contains(t, err.Error(), all[5].String())
+}
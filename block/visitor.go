@@ -0,0 +1,143 @@
+package block
+
+import (
+	"errors"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// SkipChildren may be returned by Visitor.Enter to skip the blocks below the
+// block being entered. The block is still left as normal. If the block is on
+// the query path, the traversal below it, including the remainder of the path,
+// is skipped.
+var SkipChildren = errors.New("skip children")
+
+// SkipAll may be returned by Visitor.Enter or Visitor.Leave to stop the
+// traversal immediately; the walk returns nil and no further blocks are
+// entered or left.
+var SkipAll = errors.New("skip all")
+
+// Visitor receives the blocks of a traversal, in order. Enter is called when a
+// block is reached and Leave once every block below it has been visited. Any
+// error other than SkipChildren and SkipAll aborts the traversal and is
+// returned from the walk, without leaving the blocks that were entered.
+type Visitor interface {
+	Enter(p datamodel.Path, depth int, b Block) error
+	Leave(p datamodel.Path, depth int, b Block) error
+}
+
+// VisitorFunc adapts a plain visit function to a Visitor; the function is
+// called on Enter and Leave does nothing.
+type VisitorFunc func(p datamodel.Path, depth int, b Block)
+
+func (f VisitorFunc) Enter(p datamodel.Path, depth int, b Block) error {
+	f(p, depth, b)
+	return nil
+}
+
+func (f VisitorFunc) Leave(p datamodel.Path, depth int, b Block) error {
+	return nil
+}
+
+// MissingVisitor may be implemented by a Visitor to be told of blocks that are
+// skipped because they are missing from the LinkSystem when navigating with
+// ignoreMissing. The block has DataType_Missing and carries only what is known
+// from its parent: CID, paths, shard index and, for file chunks, the expected
+// byte offset and size. Returning SkipAll stops the traversal, and any error
+// other than SkipChildren aborts it.
+type MissingVisitor interface {
+	Missing(p datamodel.Path, depth int, b Block) error
+}
+
+// MissingVisitorFunc is the same as VisitorFunc, but the function is also
+// called for missing blocks.
+type MissingVisitorFunc func(p datamodel.Path, depth int, b Block)
+
+func (f MissingVisitorFunc) Enter(p datamodel.Path, depth int, b Block) error {
+	f(p, depth, b)
+	return nil
+}
+
+func (f MissingVisitorFunc) Leave(p datamodel.Path, depth int, b Block) error {
+	return nil
+}
+
+func (f MissingVisitorFunc) Missing(p datamodel.Path, depth int, b Block) error {
+	f(p, depth, b)
+	return nil
+}
+
+// visitMissing passes a missing block to the visitor if it is a
+// MissingVisitor.
+func visitMissing(v Visitor, p datamodel.Path, depth int, blk Block) error {
+	mv, ok := v.(MissingVisitor)
+	if !ok {
+		return nil
+	}
+	if err := mv.Missing(p, depth, blk); err != nil && err != SkipChildren {
+		return err
+	}
+	return nil
+}
+
+// visit enters blk, visits its children unless asked to skip them, and leaves
+// blk.
+func visit(v Visitor, p datamodel.Path, depth int, blk Block, children func() error) error {
+	switch err := v.Enter(p, depth, blk); err {
+	case nil:
+		if err := children(); err != nil {
+			return err
+		}
+	case SkipChildren:
+	default:
+		return err
+	}
+	if err := v.Leave(p, depth, blk); err != nil && err != SkipChildren {
+		return err
+	}
+	return nil
+}
+
+type entered struct {
+	p     datamodel.Path
+	depth int
+	blk   Block
+}
+
+// pathVisitor records the blocks entered while following the query path so
+// that they can be left, innermost first, once the traversal below the
+// terminus is complete.
+type pathVisitor struct {
+	Visitor
+	entered []entered
+}
+
+func (pv *pathVisitor) enter(p datamodel.Path, depth int, blk Block) error {
+	err := pv.Enter(p, depth, blk)
+	if err == nil || err == SkipChildren {
+		pv.entered = append(pv.entered, entered{p, depth, blk})
+	}
+	return err
+}
+
+func (pv *pathVisitor) leave() error {
+	for ii := len(pv.entered) - 1; ii >= 0; ii-- {
+		e := pv.entered[ii]
+		if err := pv.Leave(e.p, e.depth, e.blk); err != nil && err != SkipChildren {
+			return err
+		}
+	}
+	pv.entered = nil
+	return nil
+}
+
+// finish resolves the control signals returned from a path walk.
+func (pv *pathVisitor) finish(err error) error {
+	if err == SkipChildren {
+		err = pv.leave()
+	}
+	if err == SkipAll {
+		return nil
+	}
+	return err
+}
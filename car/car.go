@@ -1,32 +1,79 @@
 package car
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/index"
 	storagecar "github.com/ipld/go-car/v2/storage"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
 )
 
-func LinkSystem(carFile *os.File) (ipld.LinkSystem, cid.Cid, error) {
-	storage, err := storagecar.OpenReadable(carFile)
-	if err != nil {
-		return ipld.LinkSystem{}, cid.Undef, err
+// Format describes the version of a CAR file and, for a CARv2, its index.
+type Format struct {
+	Version    uint64
+	Indexed    bool            // a CARv2 with an index
+	IndexCodec multicodec.Code // of the index, if Indexed
+	IndexStale bool            // the index doesn't match the blocks in the CAR, if checked
+}
+
+func (f Format) String() string {
+	switch {
+	case f.Version != 2:
+		return fmt.Sprintf("CARv%d", f.Version)
+	case !f.Indexed:
+		return "CARv2 without an index"
+	case f.IndexStale:
+		return fmt.Sprintf("CARv2 with a stale %s index", f.IndexCodec)
+	default:
+		return fmt.Sprintf("CARv2 with a %s index", f.IndexCodec)
 	}
+}
 
-	var root cid.Cid
+// LinkSystem opens a CAR file for reading blocks, along with its roots and its
+// format. The index of a CARv2 is used if it has one, otherwise the blocks are
+// indexed afresh, as they are for a CARv1. If checkIndex is true, the index is
+// first checked against the blocks in the CAR, as per ReadFormat, and the
+// blocks are indexed afresh if it is stale.
+func LinkSystem(carFile *os.File, checkIndex bool) (ipld.LinkSystem, []cid.Cid, Format, error) {
+	format, err := ReadFormat(carFile, checkIndex)
+	if err != nil {
+		return ipld.LinkSystem{}, nil, Format{}, err
+	}
+	var reader io.ReaderAt = carFile
+	if format.IndexStale {
+		// reading the data payload alone treats it as a CARv1, ignoring the index
+		v2r, err := carv2.NewReader(carFile)
+		if err != nil {
+			return ipld.LinkSystem{}, nil, Format{}, err
+		}
+		if reader, err = v2r.DataReader(); err != nil {
+			return ipld.LinkSystem{}, nil, Format{}, err
+		}
+	}
+	storage, err := storagecar.OpenReadable(reader)
+	if err != nil {
+		return ipld.LinkSystem{}, nil, Format{}, err
+	}
 
-	if len(storage.Roots()) == 1 {
-		root = storage.Roots()[0]
-	} else {
+	roots := storage.Roots()
+	if len(roots) == 0 {
 		// attempt infer from filename, but not fatal if we don't, caller may be
 		// able to get it from another source
 		cidStr := filepath.Base(carFile.Name())
 		cidStr = cidStr[:len(cidStr)-len(filepath.Ext(cidStr))]
-		root, _ = cid.Parse(cidStr)
+		if root, err := cid.Parse(cidStr); err == nil {
+			roots = []cid.Cid{root}
+		}
 	}
 
 	lsys := cidlink.DefaultLinkSystem()
@@ -34,5 +81,109 @@ func LinkSystem(carFile *os.File) (ipld.LinkSystem, cid.Cid, error) {
 	lsys.SetReadStorage(storage)
 	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
 
-	return lsys, root, nil
+	return lsys, roots, format, nil
+}
+
+// ReadFormat reads the version of a CAR file and, for a CARv2 with an index,
+// the codec of the index. If checkIndex is true, the index is also checked
+// against the blocks in the CAR, which reads the whole CAR and looks up every
+// block; this is the cost the index is there to avoid, so it is left to the
+// caller to ask for. The index is stale if a block can't be found with it, or
+// if it has an entry that doesn't point to a block with the same multihash.
+func ReadFormat(carFile *os.File, checkIndex bool) (Format, error) {
+	r, err := carv2.NewReader(carFile)
+	if err != nil {
+		return Format{}, err
+	}
+	format := Format{Version: r.Version}
+	if r.Version != 2 || !r.Header.HasIndex() {
+		return format, nil
+	}
+	ir, err := r.IndexReader()
+	if err != nil {
+		return Format{}, err
+	}
+	idx, err := index.ReadFrom(ir)
+	if err != nil {
+		return Format{}, err
+	}
+	format.Indexed = true
+	format.IndexCodec = idx.Codec()
+	if !checkIndex {
+		return format, nil
+	}
+	format.IndexStale, err = staleIndex(carFile, idx)
+	if err != nil {
+		return Format{}, err
+	}
+	return format, nil
+}
+
+func staleIndex(carFile *os.File, idx index.Index) (bool, error) {
+	stat, err := carFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	br, err := carv2.NewBlockReader(io.NewSectionReader(carFile, 0, stat.Size()))
+	if err != nil {
+		return false, err
+	}
+	offsets := make(map[string]map[uint64]struct{}) // by multihash
+	for {
+		md, err := br.SkipNext()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, err
+		}
+		if md.Cid.Prefix().MhType == multihash.IDENTITY {
+			continue // not indexed
+		}
+		err = idx.GetAll(md.Cid, func(uint64) bool { return false })
+		if errors.Is(err, index.ErrNotFound) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		mh := string(md.Cid.Hash())
+		if offsets[mh] == nil {
+			offsets[mh] = make(map[uint64]struct{})
+		}
+		offsets[mh][md.Offset] = struct{}{}
+	}
+	iterable, ok := idx.(index.IterableIndex)
+	if !ok {
+		return false, nil
+	}
+	var stale bool
+	err = iterable.ForEach(func(mh multihash.Multihash, offset uint64) error {
+		if _, ok := offsets[string(mh)][offset]; !ok {
+			stale = true
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// Cids lists the CIDs of all of the blocks in a CAR file, in the order they
+// appear, regardless of whether they are reachable from a root.
+func Cids(carFile *os.File) ([]cid.Cid, error) {
+	stat, err := carFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	br, err := carv2.NewBlockReader(io.NewSectionReader(carFile, 0, stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+	cids := make([]cid.Cid, 0)
+	for {
+		md, err := br.SkipNext()
+		if err == io.EOF {
+			return cids, nil
+		} else if err != nil {
+			return nil, err
+		}
+		cids = append(cids, md.Cid)
+	}
 }
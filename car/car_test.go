@@ -0,0 +1,281 @@
+package car
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/index"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/multiformats/go-multicodec"
+	"github.com/test-go/testify/require"
+)
+
+func TestLinkSystemFormat(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	generate := func(spec string, seed int64) cid.Cid {
+		entity, err := generator.Parse(spec)
+		require.NoError(t, err)
+		rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(seed)))
+		require.NoError(t, err)
+		return rootEnt.Root
+	}
+	root := generate(`dir(file:600kB{name:"a"},dir{name:"d",sharded}(20*file:1kB))`, 0)
+	otherRoot := generate(`dir(file:300kB{name:"a"},file:1kB{name:"b"})`, 1)
+
+	expected := make([]cid.Cid, 0)
+	blk, err := block.NewBlock(lsys, root)
+	require.NoError(t, err)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {
+		expected = append(expected, b.Cid)
+	}))
+
+	dir := t.TempDir()
+	writeV2 := func(name string, root cid.Cid, opts ...carv2.Option) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, carv2.TraverseToFile(context.Background(), &lsys, root, selectorparse.CommonSelector_ExploreAllRecursively, path, opts...))
+		return path
+	}
+	v1 := filepath.Join(dir, "v1.car")
+	f, err := os.Create(v1)
+	require.NoError(t, err)
+	_, err = carv2.TraverseV1(context.Background(), &lsys, root, selectorparse.CommonSelector_ExploreAllRecursively, f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	mhSorted := writeV2("mhsorted.car", root)
+	sorted := writeV2("sorted.car", root, carv2.UseIndexCodec(multicodec.CarIndexSorted))
+	none := writeV2("none.car", root, carv2.WithoutIndex())
+
+	// the data payload of one CAR with the index of another
+	stale := filepath.Join(dir, "stale.car")
+	func() {
+		a, err := carv2.OpenReader(mhSorted)
+		require.NoError(t, err)
+		defer a.Close()
+		dr, err := a.DataReader()
+		require.NoError(t, err)
+		data, err := io.ReadAll(dr)
+		require.NoError(t, err)
+		b, err := carv2.OpenReader(writeV2("other.car", otherRoot))
+		require.NoError(t, err)
+		defer b.Close()
+		ir, err := b.IndexReader()
+		require.NoError(t, err)
+		idx, err := index.ReadFrom(ir)
+		require.NoError(t, err)
+
+		out, err := os.Create(stale)
+		require.NoError(t, err)
+		defer out.Close()
+		_, err = out.Write(carv2.Pragma)
+		require.NoError(t, err)
+		_, err = carv2.NewHeader(uint64(len(data))).WriteTo(out)
+		require.NoError(t, err)
+		_, err = out.Write(data)
+		require.NoError(t, err)
+		_, err = index.WriteTo(idx, out)
+		require.NoError(t, err)
+	}()
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected Format
+		str      string
+	}{
+		{"v1", v1, Format{Version: 1}, "CARv1"},
+		{"v2 multihash sorted", mhSorted, Format{Version: 2, Indexed: true, IndexCodec: multicodec.CarMultihashIndexSorted}, "CARv2 with a car-multihash-index-sorted index"},
+		{"v2 sorted", sorted, Format{Version: 2, Indexed: true, IndexCodec: multicodec.CarIndexSorted}, "CARv2 with a car-index-sorted index"},
+		{"v2 no index", none, Format{Version: 2}, "CARv2 without an index"},
+		{"v2 stale index", stale, Format{Version: 2, Indexed: true, IndexCodec: multicodec.CarMultihashIndexSorted, IndexStale: true}, "CARv2 with a stale car-multihash-index-sorted index"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := require.New(t)
+			carFile, err := os.Open(tc.path)
+			req.NoError(err)
+			defer carFile.Close()
+
+			// the index is only checked against the blocks when asked
+			format, err := ReadFormat(carFile, false)
+			req.NoError(err)
+			unchecked := tc.expected
+			unchecked.IndexStale = false
+			req.Equal(unchecked, format)
+
+			ls, roots, format, err := LinkSystem(carFile, true)
+			req.NoError(err)
+			req.Equal([]cid.Cid{root}, roots)
+			req.Equal(tc.expected, format)
+			req.Equal(tc.str, format.String())
+
+			blk, err := block.NewBlock(ls, root)
+			req.NoError(err)
+			actual := make([]cid.Cid, 0)
+			req.NoError(blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {
+				actual = append(actual, b.Cid)
+			}))
+			req.Equal(expected, actual)
+		})
+	}
+}
+
+func TestWriteRoots(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entities, err := generator.ParseRoots("dir(file:600kB{zero,name:\"a\"},dir{name:\"d\",sharded}(20*file:1kB))\nfile:300kB{zero}\nmap(string:\"hello\")")
+	require.NoError(t, err)
+	rnd := rand.New(rand.NewSource(0))
+	roots := make([]cid.Cid, 0)
+	for _, entity := range entities {
+		rootEnt, err := entity.Generate(lsys, rnd)
+		require.NoError(t, err)
+		roots = append(roots, rootEnt.Root)
+	}
+
+	// each DAG in turn, with blocks shared by them, such as the zero chunks,
+	// written once
+	expectedCids := func(roots []cid.Cid) []cid.Cid {
+		expected := make([]cid.Cid, 0)
+		seen := make(map[cid.Cid]struct{})
+		for _, root := range roots {
+			blk, err := block.NewBlock(lsys, root)
+			require.NoError(t, err)
+			require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {
+				if _, ok := seen[b.Cid]; !ok {
+					seen[b.Cid] = struct{}{}
+					expected = append(expected, b.Cid)
+				}
+			}))
+		}
+		return expected
+	}
+
+	testCases := []struct {
+		name     string
+		v2       bool
+		opts     []carv2.Option
+		expected Format
+	}{
+		{"v1", false, nil, Format{Version: 1}},
+		{"v2", true, nil, Format{Version: 2, Indexed: true, IndexCodec: multicodec.CarMultihashIndexSorted}},
+		{"v2 sorted", true, []carv2.Option{carv2.UseIndexCodec(multicodec.CarIndexSorted)}, Format{Version: 2, Indexed: true, IndexCodec: multicodec.CarIndexSorted}},
+		{"v2 no index", true, []carv2.Option{carv2.WithoutIndex()}, Format{Version: 2}},
+	}
+	// the options apply the same to a single root as to several
+	for _, roots := range [][]cid.Cid{roots[:1], roots} {
+		expected := expectedCids(roots)
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s/%d roots", tc.name, len(roots)), func(t *testing.T) {
+				req := require.New(t)
+				path := filepath.Join(t.TempDir(), "roots.car")
+				req.NoError(WriteRoots(context.Background(), lsys, roots, path, tc.v2, tc.opts...))
+
+				carFile, err := os.Open(path)
+				req.NoError(err)
+				defer carFile.Close()
+				ls, carRoots, format, err := LinkSystem(carFile, false)
+				req.NoError(err)
+				req.Equal(roots, carRoots)
+				req.Equal(tc.expected, format)
+				if tc.v2 {
+					header, err := carv2.NewReader(carFile)
+					req.NoError(err)
+					req.Equal(tc.expected.Indexed, header.Header.HasIndex())
+				}
+
+				cids, err := Cids(carFile)
+				req.NoError(err)
+				req.Equal(expected, cids)
+
+				for _, root := range roots {
+					blk, err := block.NewBlock(ls, root)
+					req.NoError(err)
+					req.NoError(blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {}))
+				}
+			})
+		}
+	}
+}
+
+func TestExplainRoots(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	// two files sharing their zero chunk, in a CAR with both as roots
+	entities, err := generator.ParseRoots("file:600kB{zero}\nfile:300kB{zero}")
+	require.NoError(t, err)
+	rnd := rand.New(rand.NewSource(0))
+	roots := make([]cid.Cid, 0)
+	for _, entity := range entities {
+		rootEnt, err := entity.Generate(lsys, rnd)
+		require.NoError(t, err)
+		roots = append(roots, rootEnt.Root)
+	}
+	path := filepath.Join(t.TempDir(), "roots.car")
+	require.NoError(t, WriteRoots(context.Background(), lsys, roots, path, false))
+	carFile, err := os.Open(path)
+	require.NoError(t, err)
+	defer carFile.Close()
+	ls, carRoots, _, err := LinkSystem(carFile, false)
+	require.NoError(t, err)
+	require.Equal(t, roots, carRoots)
+
+	// as explain does, the same visitors walk each root in turn, without
+	// duplicates, and each root still lists the chunk shared with the first
+	records := make([]block.Record, 0)
+	recordVisitor := block.RecordVisitor(false, func(r block.Record) { records = append(records, r) })
+	var text strings.Builder
+	textVisitor := block.WritingVisitor(&text, false, true)
+	for _, root := range carRoots {
+		blk, err := block.NewBlock(ls, root)
+		require.NoError(t, err)
+		require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {
+			recordVisitor(p, depth, b)
+			textVisitor(p, depth, b)
+		}))
+	}
+	// the first root is a file of three chunks, the first two identical, and
+	// the second a file of two chunks, the first the same as the first root's;
+	// each root, and its distinct chunks
+	require.Len(t, records, 3+3)
+	perRoot := make(map[string][]string)
+	for _, r := range records {
+		require.False(t, r.Duplicate)
+		perRoot[r.Root] = append(perRoot[r.Root], r.Cid)
+	}
+	require.Len(t, perRoot[roots[0].String()], 3)
+	require.Len(t, perRoot[roots[1].String()], 3)
+	shared := perRoot[roots[0].String()][1]
+	require.Equal(t, shared, perRoot[roots[1].String()][1])
+	require.Equal(t, 2, strings.Count(text.String(), shared))
+}
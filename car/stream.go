@@ -0,0 +1,190 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	storagecar "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+// Stream is a read-only block store over a CAR stream, such as the body of a
+// trustless gateway response, that needs neither an index nor seeking. Blocks
+// are only read from the stream as they are asked for, so a traversal over it
+// proceeds in arrival order as a trustless client's would, and the hash of
+// each block is checked as it arrives. Blocks that arrive while the traversal
+// is waiting for a different one are kept for when they are asked for, and
+// are reported as early if none of the blocks asked for so far link to them.
+//
+// Every block read is kept until the Stream is discarded, as a block that has
+// been asked for may be asked for again by a parent that is yet to arrive,
+// and a stream without duplicates won't repeat it. Memory use therefore grows
+// with the size of the stream, as it would for a CAR read in full.
+type Stream struct {
+	br      *carv2.BlockReader
+	onEarly func(index int, c cid.Cid, wanted cid.Cid)
+	index   int                // of the next block in the stream
+	next    cid.Cid            // the next block in the stream, if it has been read
+	read    map[cid.Cid][]byte // every block read from the stream
+	order   []cid.Cid          // distinct blocks in the order they were read
+	used    map[cid.Cid]struct{}
+	linked  map[cid.Cid]struct{} // the roots, and the links of the blocks used
+	eof     bool
+}
+
+// NewStream reads the header of a CAR stream. onEarly, if not nil, is called
+// with the position in the stream of each block that arrives before any of
+// the blocks asked for so far link to it, along with the block that was being
+// waited for.
+func NewStream(r io.Reader, onEarly func(index int, c cid.Cid, wanted cid.Cid)) (*Stream, error) {
+	br, err := carv2.NewBlockReader(r)
+	if err != nil {
+		return nil, err
+	}
+	linked := make(map[cid.Cid]struct{})
+	for _, root := range br.Roots {
+		linked[root] = struct{}{}
+	}
+	return &Stream{
+		br:      br,
+		onEarly: onEarly,
+		read:    make(map[cid.Cid][]byte),
+		used:    make(map[cid.Cid]struct{}),
+		linked:  linked,
+	}, nil
+}
+
+// Roots returns the roots in the header of the stream.
+func (s *Stream) Roots() []cid.Cid {
+	return s.br.Roots
+}
+
+// LinkSystem returns a LinkSystem that loads blocks from the stream.
+func (s *Stream) LinkSystem() ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	lsys.SetReadStorage(s)
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	return lsys
+}
+
+// Has reports whether the block has been read from the stream so far.
+func (s *Stream) Has(ctx context.Context, key string) (bool, error) {
+	c, err := cid.Cast([]byte(key))
+	if err != nil {
+		return false, err
+	}
+	_, ok := s.read[c]
+	return ok, nil
+}
+
+// Get returns the block if it is next in the stream, or has already been read
+// from it. Otherwise blocks are read from the stream until it is found, and
+// those that nothing asked for so far links to are reported as early. If the
+// stream ends first, a not found error is returned.
+func (s *Stream) Get(ctx context.Context, key string) ([]byte, error) {
+	c, err := cid.Cast([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := s.peek(); err != nil {
+			return nil, err
+		}
+		if s.next == c {
+			s.next = cid.Undef
+			s.index++
+			s.use(c)
+			return s.read[c], nil
+		}
+		if byts, ok := s.read[c]; ok {
+			// already arrived, this is a duplicate that the stream omits
+			s.use(c)
+			return byts, nil
+		}
+		if s.next == cid.Undef {
+			return nil, storagecar.ErrNotFound{Cid: c}
+		}
+		if _, ok := s.linked[s.next]; !ok && s.onEarly != nil {
+			s.onEarly(s.index, s.next, c)
+		}
+		s.next = cid.Undef
+		s.index++
+	}
+}
+
+// use marks a block as asked for, and records the blocks it links to.
+func (s *Stream) use(c cid.Cid) {
+	if _, ok := s.used[c]; ok {
+		return
+	}
+	s.used[c] = struct{}{}
+	decoder, err := multicodec.LookupDecoder(c.Prefix().Codec)
+	if err != nil {
+		return // no decoder, and so no known links, e.g. raw
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := decoder(nb, bytes.NewReader(s.read[c])); err != nil {
+		return // the traversal will fail to decode it too
+	}
+	links, err := traversal.SelectLinks(nb.Build())
+	if err != nil {
+		return
+	}
+	for _, l := range links {
+		if cl, ok := l.(cidlink.Link); ok {
+			s.linked[cl.Cid] = struct{}{}
+		}
+	}
+}
+
+// Unused reads the remainder of the stream and returns the distinct blocks in
+// it that were never asked for, in arrival order.
+func (s *Stream) Unused() ([]cid.Cid, error) {
+	for {
+		if err := s.peek(); err != nil {
+			return nil, err
+		}
+		if s.next == cid.Undef {
+			break
+		}
+		s.next = cid.Undef
+		s.index++
+	}
+	unused := make([]cid.Cid, 0)
+	for _, c := range s.order {
+		if _, ok := s.used[c]; !ok {
+			unused = append(unused, c)
+		}
+	}
+	return unused, nil
+}
+
+// peek reads the next block from the stream, if it hasn't been already and
+// the stream hasn't ended.
+func (s *Stream) peek() error {
+	if s.next != cid.Undef || s.eof {
+		return nil
+	}
+	blk, err := s.br.Next()
+	if err == io.EOF {
+		s.eof = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.next = blk.Cid()
+	if _, ok := s.read[blk.Cid()]; !ok {
+		s.read[blk.Cid()] = blk.RawData()
+		s.order = append(s.order, blk.Cid())
+	}
+	return nil
+}
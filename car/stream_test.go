@@ -0,0 +1,107 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode"
+	carv2 "github.com/ipld/go-car/v2"
+	storagecar "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-fixtureplate/generator"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	"github.com/test-go/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	entity, err := generator.Parse(`dir(file:600kB{zero,name:"a"},file:1kB{name:"b"})`)
+	require.NoError(t, err)
+	rootEnt, err := entity.Generate(lsys, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+	blk, err := block.NewBlock(lsys, rootEnt.Root)
+	require.NoError(t, err)
+
+	dfs := make([]cid.Cid, 0)
+	require.NoError(t, blk.Navigate(datamodel.Path{}, trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, false, func(p datamodel.Path, depth int, b block.Block) {
+		dfs = append(dfs, b.Cid)
+	}))
+	require.Len(t, dfs, 6)
+	root, a, chunk, lastChunk, b := dfs[0], dfs[1], dfs[2], dfs[4], dfs[5]
+	// a block from another DAG
+	otherEntity, err := generator.Parse(`file:1kB`)
+	require.NoError(t, err)
+	otherEnt, err := otherEntity.Generate(lsys, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	other := otherEnt.Root
+
+	type early struct {
+		index           int
+		arrived, wanted cid.Cid
+	}
+	testCases := []struct {
+		name            string
+		stream          []cid.Cid
+		path            string
+		ignoreMissing   bool
+		expectedVisited []cid.Cid
+		expectedEarly   []early
+		expectedUnused  []cid.Cid
+	}{
+		{"in order", dfs, "", false, dfs, []early{}, []cid.Cid{}},
+		{"no dups", []cid.Cid{root, a, chunk, lastChunk, b}, "", false, dfs, []early{}, []cid.Cid{}},
+		{"child first", []cid.Cid{root, b, a, chunk, chunk, lastChunk}, "", false, dfs, []early{}, []cid.Cid{}},
+		{"before parent", []cid.Cid{root, chunk, a, lastChunk, b}, "", false, dfs, []early{{1, chunk, a}}, []cid.Cid{}},
+		{"trailing", append(dfs[:6:6], other), "", false, dfs, []early{}, []cid.Cid{other}},
+		{"unused", dfs, "b", false, []cid.Cid{root, b}, []early{{2, chunk, b}, {3, chunk, b}, {4, lastChunk, b}}, []cid.Cid{a, chunk, lastChunk}},
+		{"missing", []cid.Cid{root, a, chunk, chunk, b}, "", true, []cid.Cid{root, a, chunk, chunk, b}, []early{}, []cid.Cid{}},
+		{"unrelated", []cid.Cid{root, other, a, chunk, lastChunk, b}, "", false, dfs, []early{{1, other, a}}, []cid.Cid{other}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := require.New(t)
+			var buf bytes.Buffer
+			car, err := storagecar.NewWritable(struct{ io.Writer }{&buf}, []cid.Cid{root}, carv2.WriteAsCarV1(true), carv2.AllowDuplicatePuts(true))
+			req.NoError(err)
+			for _, c := range tc.stream {
+				byts, err := lsys.LoadRaw(linking.LinkContext{}, cidlink.Link{Cid: c})
+				req.NoError(err)
+				req.NoError(car.Put(context.Background(), c.KeyString(), byts))
+			}
+
+			actualEarly := make([]early, 0)
+			stream, err := NewStream(&buf, func(index int, arrived cid.Cid, wanted cid.Cid) {
+				actualEarly = append(actualEarly, early{index, arrived, wanted})
+			})
+			req.NoError(err)
+			req.Equal([]cid.Cid{root}, stream.Roots())
+			sls := stream.LinkSystem()
+			sblk, err := block.NewBlock(sls, root)
+			req.NoError(err)
+			visited := make([]cid.Cid, 0)
+			req.NoError(sblk.Navigate(datamodel.ParsePath(tc.path), trustlessutils.DagScopeAll, trustlessutils.ByteRange{}, tc.ignoreMissing, func(p datamodel.Path, depth int, b block.Block) {
+				visited = append(visited, b.Cid)
+			}))
+			req.Equal(tc.expectedVisited, visited)
+			req.Equal(tc.expectedEarly, actualEarly)
+
+			unused, err := stream.Unused()
+			req.NoError(err)
+			req.Equal(tc.expectedUnused, unused)
+		})
+	}
+}
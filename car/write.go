@@ -0,0 +1,122 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/index"
+	storagecar "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+)
+
+// WriteRoots writes a CAR file with one or more roots, containing the full DAG
+// under each root in turn, in traversal order, with each block written once.
+// This is the multiple root equivalent of go-car's TraverseV1 and, if v2 is
+// true, TraverseToFile, which also honours the UseIndexCodec and WithoutIndex
+// options whatever the number of roots.
+func WriteRoots(ctx context.Context, lsys ipld.LinkSystem, roots []cid.Cid, destination string, v2 bool, opts ...carv2.Option) error {
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if !v2 {
+		return writeV1(ctx, lsys, roots, out)
+	}
+
+	v1, err := os.CreateTemp("", "fixtureplate-*.car")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		v1.Close()
+		os.Remove(v1.Name())
+	}()
+	if err := writeV1(ctx, lsys, roots, v1); err != nil {
+		return err
+	}
+	if _, err := v1.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if carv2.ApplyOptions(opts...).IndexCodec != index.CarIndexNone {
+		return carv2.WrapV1(v1, out, opts...)
+	}
+	// WrapV1 always writes an index
+	size, err := v1.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := v1.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := carv2.NewHeader(uint64(size))
+	header.IndexOffset = 0
+	if _, err := out.Write(carv2.Pragma); err != nil {
+		return err
+	}
+	if _, err := header.WriteTo(out); err != nil {
+		return err
+	}
+	_, err = io.Copy(out, v1)
+	return err
+}
+
+// writeV1 writes each block loaded by a traversal of the full DAG under each
+// root, as it is loaded.
+func writeV1(ctx context.Context, lsys ipld.LinkSystem, roots []cid.Cid, w io.Writer) error {
+	// hide any io.WriterAt so that the CAR is always streamed in order
+	car, err := storagecar.NewWritable(struct{ io.Writer }{w}, roots, carv2.WriteAsCarV1(true))
+	if err != nil {
+		return err
+	}
+	sro := lsys.StorageReadOpener
+	lsys.StorageReadOpener = func(lc linking.LinkContext, l datamodel.Link) (io.Reader, error) {
+		r, err := sro(lc, l)
+		if err != nil {
+			return nil, err
+		}
+		byts, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		// duplicates are ignored by the CAR
+		if err := car.Put(ctx, l.(cidlink.Link).Cid.KeyString(), byts); err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(byts), nil
+	}
+	sel, err := selector.CompileSelector(selectorparse.CommonSelector_ExploreAllRecursively)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		lctx := linking.LinkContext{Ctx: ctx}
+		node, err := lsys.Load(lctx, cidlink.Link{Cid: root}, basicnode.Prototype.Any)
+		if err != nil {
+			return err
+		}
+		prog := traversal.Progress{Cfg: &traversal.Config{
+			Ctx:        ctx,
+			LinkSystem: lsys,
+			LinkTargetNodePrototypeChooser: func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+				return basicnode.Prototype.Any, nil
+			},
+			LinkVisitOnlyOnce: true,
+		}}
+		if err := prog.WalkAdv(node, sel, func(traversal.Progress, datamodel.Node, traversal.VisitReason) error { return nil }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
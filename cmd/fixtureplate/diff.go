@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	cli "github.com/urfave/cli/v2"
+)
+
+var diffCommand = &cli.Command{
+	Name: "diff",
+	Usage: "Compare the DAGs inside two CAR files and show the UnixFS paths that" +
+		" were added, removed or changed, and the blocks they share",
+	Flags: []cli.Flag{
+		checkIndexFlag,
+		&cli.StringSliceFlag{
+			Name: "root",
+			Usage: "Override the root CID of the CAR files, needed for a CAR with" +
+				" more than one root; given once it applies to both, given twice" +
+				" the first applies to a.car and the second to b.car",
+		},
+	},
+	ArgsUsage: "<a.car> <b.car>",
+	Action:    diffAction,
+}
+
+func diffAction(c *cli.Context) error {
+	if c.Args().Len() != 2 {
+		return fmt.Errorf("expected two CAR files to compare")
+	}
+
+	rootStrs := c.StringSlice("root")
+	if len(rootStrs) > 2 {
+		return fmt.Errorf("expected --root at most twice, once for each CAR file")
+	}
+	roots := []cid.Cid{cid.Undef, cid.Undef}
+	for ii, rootStr := range rootStrs {
+		root, err := cid.Parse(rootStr)
+		if err != nil {
+			return err
+		}
+		roots[ii] = root
+	}
+	if len(rootStrs) == 1 {
+		roots[1] = roots[0]
+	}
+
+	a, carFileA, err := loadCar(c.Context, c.App.ErrWriter, roots[0], c.Args().Get(0), c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFileA.Close()
+	b, carFileB, err := loadCar(c.Context, c.App.ErrWriter, roots[1], c.Args().Get(1), c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFileB.Close()
+
+	fmt.Fprintf(c.App.Writer, "--- %s\n+++ %s\n", a.Cid, b.Cid)
+	if a.Cid == b.Cid {
+		fmt.Fprintln(c.App.Writer, "DAGs are identical")
+		return nil
+	}
+
+	diff, err := block.Diff(c.Context, a, b)
+	if err != nil {
+		return err
+	}
+	for _, e := range diff.Removed {
+		fmt.Fprintf(c.App.Writer, "- /%s (%s)\n", e.Path, entityString(e))
+	}
+	for _, e := range diff.Added {
+		fmt.Fprintf(c.App.Writer, "+ /%s (%s)\n", e.Path, entityString(e))
+	}
+	for _, ch := range diff.Changed {
+		writeChange(c.App.Writer, ch)
+	}
+	fmt.Fprintf(c.App.Writer, "%s shared, %d only in %s, %d only in %s\n", plural(diff.Shared, "block", "blocks"), diff.OnlyA, a.Cid, diff.OnlyB, b.Cid)
+	return nil
+}
+
+func entityString(e block.Entity) string {
+	if len(e.Leaves) > 0 {
+		return fmt.Sprintf("%s, %s B in %s", e.DataType, humanize.Comma(e.Length), plural(len(e.Leaves), "leaf", "leaves"))
+	}
+	return e.DataType
+}
+
+func writeChange(w io.Writer, ch block.EntityChange) {
+	changes := make([]string, 0)
+	if ch.TypeChanged() {
+		changes = append(changes, fmt.Sprintf("%s → %s", ch.A.DataType, ch.B.DataType))
+	}
+	if ch.LengthChanged() {
+		changes = append(changes, fmt.Sprintf("%s B → %s B", humanize.Comma(ch.A.Length), humanize.Comma(ch.B.Length)))
+	}
+	if ch.ChunkingChanged() {
+		if len(ch.A.Leaves) == len(ch.B.Leaves) {
+			changes = append(changes, "chunking changed (leaf sizes differ)")
+		} else {
+			changes = append(changes, fmt.Sprintf("chunking changed (%s → %s)", plural(len(ch.A.Leaves), "leaf", "leaves"), plural(len(ch.B.Leaves), "leaf", "leaves")))
+		}
+	}
+	if ch.ShapeChanged() {
+		changes = append(changes, fmt.Sprintf("shape changed (%s → %s)", plural(ch.A.Blocks, "block", "blocks"), plural(ch.B.Blocks, "block", "blocks")))
+	}
+	if len(changes) == 0 {
+		if len(ch.A.Leaves) > 0 {
+			changes = append(changes, "content changed")
+		} else {
+			changes = append(changes, "entries changed")
+		}
+	}
+	fmt.Fprintf(w, "~ /%s (%s): %s\n", ch.A.Path, ch.A.DataType, strings.Join(changes, ", "))
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-fixtureplate/block"
 	"github.com/ipld/go-fixtureplate/car"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
 	trustlessutils "github.com/ipld/go-trustless-utils"
 	cli "github.com/urfave/cli/v2"
 )
@@ -18,52 +24,39 @@ var explainCommand = &cli.Command{
 	Name: "explain",
 	Usage: "Execute a trustless query across a DAG inside a CAR file and show" +
 		" the block traversal details",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:  "car",
-			Usage: "CAR file to read from, if not supplied, the first unnamed argument will be used",
-		},
-		&cli.StringFlag{
-			Name:  "root",
-			Usage: "Override the root CID of the CAR file or query",
-		},
-		&cli.StringFlag{
-			Name:        "path",
-			Usage:       "Path to query, required unless --query is specified",
-			DefaultText: "/",
-		},
-		&cli.StringFlag{
-			Name:        "scope",
-			Aliases:     []string{"dag-scope"},
-			DefaultText: "all",
-			Usage:       "Scope of the query, one of: all, entity, block",
+	Flags: append([]cli.Flag{carFlag, checkIndexFlag}, queryFlags(
+		&cli.BoolFlag{
+			Name:  "full-path",
+			Value: true,
+			Usage: "Print the full path of each block, not just the last path",
 		},
-		&cli.StringFlag{
-			Name:    "bytes",
-			Aliases: []string{"entity-bytes"},
-			Value:   "",
-			Usage: "Byte range of the terminating entity if that entity is a" +
-				" sharded file of the form `from:to`, where * is a valid `to`" +
-				" value and negative `to` values are also valid",
+		&cli.BoolFlag{
+			Name:  "ipld-path",
+			Value: false,
+			Usage: "Interpret the path as a raw IPLD data model path (e.g." +
+				" Links/3/Hash) rather than a UnixFS path, and print the IPLD path" +
+				" of each block. Useful for seeing what a selector-based client that" +
+				" doesn't interpret UnixFS would traverse.",
 		},
 		&cli.BoolFlag{
-			Name:        "duplicates",
-			Aliases:     []string{"dups"},
-			DefaultText: "true",
-			Usage:       "Include duplicate blocks in the output",
+			Name:  "print-selector",
+			Value: false,
+			Usage: "Print the IPLD selector, in dag-json form, that is equivalent to" +
+				" the query",
 		},
 		&cli.BoolFlag{
-			Name:  "full-path",
-			Value: true,
-			Usage: "Print the full path of each block, not just the last path",
+			Name:  "verify-traversal",
+			Value: false,
+			Usage: "Cross-check the explained traversal against a go-ipld-prime" +
+				" selector traversal of the same query and report any divergence",
 		},
 		&cli.StringFlag{
-			Name: "query",
-			Usage: "Full query (e.g. /ipfs/bafy.../path?dag-scope=all&dups=n&byte-range=0:*)" +
-				" (will be overridden by --path, --scope, --bytes and --duplicates," +
-				" if set; note that this is not strictly a trustless query as it" +
-				" incorporates elements, such as 'dups', that are normally included" +
-				" in the Accept header)",
+			Name:  "format",
+			Value: "text",
+			Usage: "Output format, one of: text, json, ndjson, csv, dot, mermaid." +
+				" Structured formats emit one record per visited block, dot" +
+				" (Graphviz) and mermaid render the traversal as a graph; for all but" +
+				" text, the query and other informational output is written to stderr",
 		},
 		&cli.BoolFlag{
 			Name:  "ignore-missing",
@@ -72,114 +65,297 @@ var explainCommand = &cli.Command{
 				" partial CAR and want to do a full (path=/) listing to see what's in" +
 				" it.",
 		},
-	},
+		&cli.BoolFlag{
+			Name:  "report-missing",
+			Value: false,
+			Usage: "Implies --ignore-missing, but rather than omitting missing blocks," +
+				" include them in the output with a data type of Missing, along with" +
+				" their expected path and byte range, and print a count of them at" +
+				" the end.",
+		},
+	)...),
 	Action: explainAction,
 }
 
 func explainAction(c *cli.Context) error {
-	carPath := c.String("car")
-	if carPath == "" {
-		if c.Args().Len() > 0 {
-			carPath = c.Args().First()
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	root, path, scope, duplicates, byteRange, err := parseQueryFlags(c)
+	if err != nil {
+		return err
+	}
+
+	fullPath := c.Bool("full-path")
+
+	format := c.String("format")
+	// informational output goes to stderr for structured formats so that
+	// stdout remains parseable
+	info := c.App.Writer
+	var v block.Visitor
+	var records []block.Record
+	var graph *block.Graph
+	switch format {
+	case "text":
+		if c.Bool("ipld-path") {
+			v = block.VisitorFunc(block.IpldWritingVisitor(c.App.Writer, duplicates, fullPath))
 		} else {
-			return fmt.Errorf("no CAR file specified")
+			v = block.VisitorFunc(block.WritingVisitor(c.App.Writer, duplicates, fullPath))
 		}
+	case "json":
+		info = c.App.ErrWriter
+		records = make([]block.Record, 0)
+		v = block.VisitorFunc(block.RecordVisitor(duplicates, func(r block.Record) { records = append(records, r) }))
+	case "ndjson":
+		info = c.App.ErrWriter
+		v = block.NdjsonVisitor(c.App.Writer, duplicates)
+	case "csv":
+		info = c.App.ErrWriter
+		if v, err = block.CsvVisitor(c.App.Writer, duplicates); err != nil {
+			return err
+		}
+	case "dot", "mermaid":
+		info = c.App.ErrWriter
+		graph = block.NewGraph(path, c.Bool("ipld-path"))
+		v = block.VisitorFunc(graph.Visit)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
 	}
 
-	path := datamodel.Path{}
-	scope := trustlessutils.DagScopeAll
-	duplicates := true
-	var byteRange *trustlessutils.ByteRange
-	var err error
-	var root cid.Cid
+	if c.Bool("ipld-path") && (c.Bool("print-selector") || c.Bool("verify-traversal")) {
+		return fmt.Errorf("--print-selector and --verify-traversal are not supported with --ipld-path")
+	}
 
-	if c.IsSet("query") {
-		if root, path, scope, duplicates, byteRange, err = block.ParseQuery(c.String("query")); err != nil {
+	var ls linking.LinkSystem
+	var roots []cid.Cid
+	var stream *car.Stream
+	var early int
+	if carPath == "-" {
+		ls, roots, stream, err = openStream(c.App.ErrWriter, root, c.App.Reader, func(index int, arrived cid.Cid, wanted cid.Cid) {
+			fmt.Fprintf(info, "Block %d of the stream, %s, arrived before it was referenced, while waiting for %s\n", index, arrived, wanted)
+			early++
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		var carFile *os.File
+		if ls, roots, _, carFile, err = openCar(c.App.ErrWriter, root, carPath, c.Bool("check-index")); err != nil {
 			return err
 		}
+		defer carFile.Close()
 	}
 
-	if c.IsSet("path") {
-		path = datamodel.ParsePath(c.String("path"))
+	ignoreMissing := c.Bool("ignore-missing")
+	missing := make(map[cid.Cid]struct{})
+	if c.Bool("report-missing") {
+		ignoreMissing = true
+		v = reportingVisitor{Visitor: v, missing: missing}
 	}
 
-	if c.IsSet("root") {
-		root, err = cid.Parse(c.String("root"))
+	// the query is executed for each root of a CAR with more than one, loading
+	// each in turn so that a stream is read in order; the text and record
+	// visitors start afresh at each root, so duplicates are judged per root,
+	// while a graph draws them all together
+	for _, root := range roots {
+		blk, err := block.NewBlockContext(c.Context, ls, root)
 		if err != nil {
 			return err
 		}
-	}
+		fmt.Fprintln(info, block.PrintableQuery(blk.Cid, path, scope, byteRange, duplicates))
+
+		scope, br := entityByteRange(c.App.ErrWriter, scope, byteRange)
+
+		if c.Bool("print-selector") {
+			if err := dagjson.Encode(block.QuerySelector(path, scope, &br), info); err != nil {
+				return err
+			}
+			fmt.Fprintln(info)
+		}
 
-	if c.IsSet("scope") {
-		scope, err = trustlessutils.ParseDagScope(c.String("scope"))
+		if byteRange != nil && !c.Bool("ipld-path") {
+			res, err := blk.ResolveByteRange(c.Context, path, br, ignoreMissing)
+			if err := writeByteRange(info, res, err, br); err != nil {
+				return err
+			}
+		}
+
+		if c.Bool("ipld-path") {
+			err = blk.WalkIpldContext(c.Context, path, scope, br, ignoreMissing, v)
+		} else {
+			err = blk.WalkContext(c.Context, path, scope, br, ignoreMissing, v)
+		}
 		if err != nil {
 			return err
 		}
+
+		if c.Bool("verify-traversal") {
+			if err := blk.VerifyTraversalContext(c.Context, path, scope, br, duplicates); err != nil {
+				return err
+			}
+			fmt.Fprintln(info, "Traversal matches go-ipld-prime selector traversal")
+		}
 	}
 
-	if c.IsSet("bytes") {
-		br, err := trustlessutils.ParseByteRange(c.String("bytes"))
+	if records != nil {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(records); err != nil {
+			return err
+		}
+	}
+
+	if graph != nil {
+		if format == "dot" {
+			err = graph.WriteDot(c.App.Writer)
+		} else {
+			err = graph.WriteMermaid(c.App.Writer)
+		}
 		if err != nil {
 			return err
 		}
-		byteRange = &br
 	}
 
-	if c.IsSet("duplicates") {
-		duplicates = c.Bool("duplicates")
+	if c.Bool("report-missing") {
+		fmt.Fprintf(info, "%d missing blocks\n", len(missing))
 	}
 
-	fullPath := c.Bool("full-path")
+	if stream != nil {
+		unused, err := stream.Unused()
+		if err != nil {
+			return err
+		}
+		for _, u := range unused {
+			fmt.Fprintf(info, "Block %s of the stream was never referenced\n", u)
+		}
+		fmt.Fprintf(info, "%s arrived early, %s never referenced\n", plural(early, "block", "blocks"), plural(len(unused), "block was", "blocks were"))
+	}
+	return nil
+}
 
-	blk, carFile, err := loadCar(c.App.ErrWriter, root, carPath)
-	if err != nil {
+// writeByteRange writes a summary of how the byte range resolved, or that it
+// doesn't apply to the entity at the terminus of the path.
+func writeByteRange(w io.Writer, res block.ByteRangeResolution, err error, br trustlessutils.ByteRange) error {
+	var unsupported block.ErrUnsupportedDataType
+	if errors.As(err, &unsupported) {
+		fmt.Fprintf(w, "Byte range %s does not apply to %s\n", br.String(), unsupported.DataType)
+		return nil
+	} else if err != nil {
 		return err
 	}
-	defer carFile.Close()
+	res.Write(w)
+	return nil
+}
 
-	fmt.Println(block.PrintableQuery(blk.Cid, path, scope, byteRange, duplicates))
+// reportingVisitor passes missing blocks on to the Visitor as though they had
+// been entered, so they are included in the output, and collects their CIDs.
+type reportingVisitor struct {
+	block.Visitor
+	missing map[cid.Cid]struct{}
+}
 
-	if byteRange != nil {
-		if scope != trustlessutils.DagScopeEntity {
-			fmt.Fprintf(c.App.ErrWriter, "WARNING: byte range specified, but scope is not entity, switching to entity scope\n")
-			scope = trustlessutils.DagScopeEntity
-		}
-	} else {
-		br, _ := trustlessutils.ParseByteRange("")
-		byteRange = &br
+func (rv reportingVisitor) Missing(p datamodel.Path, depth int, blk block.Block) error {
+	rv.missing[blk.Cid] = struct{}{}
+	if err := rv.Enter(p, depth, blk); err != nil && err != block.SkipChildren {
+		return err
+	}
+	return nil
+}
+
+// loadCar loads the root block of a CAR file, or of requestedRoot if set. A CAR
+// with more than one root needs the root to be requested. If checkIndex is
+// true, the index of a CARv2 is checked against its blocks before use.
+func loadCar(ctx context.Context, printWriter io.Writer, requestedRoot cid.Cid, carPath string, checkIndex bool) (block.Block, *os.File, error) {
+	ls, roots, _, carFile, err := openCar(printWriter, requestedRoot, carPath, checkIndex)
+	if err != nil {
+		return block.Block{}, nil, err
 	}
+	blk, err := loadRoot(ctx, ls, roots)
+	if err != nil {
+		carFile.Close()
+		return block.Block{}, nil, err
+	}
+	return blk, carFile, nil
+}
 
-	return blk.Navigate(path, scope, *byteRange, c.Bool("ignore-missing"), block.WritingVisitor(c.App.Writer, duplicates, fullPath))
+// loadRoot loads the root block of a CAR with a single root, or with the root
+// that was requested.
+func loadRoot(ctx context.Context, ls linking.LinkSystem, roots []cid.Cid) (block.Block, error) {
+	if len(roots) > 1 {
+		return block.Block{}, fmt.Errorf("CAR file has %d roots, specify one with --root", len(roots))
+	}
+	return block.NewBlockContext(ctx, ls, roots[0])
 }
 
-func loadCar(printWriter io.Writer, requestedRoot cid.Cid, carPath string) (block.Block, *os.File, error) {
+// openCar opens a CAR file for loading blocks, reporting on its index, along
+// with its roots, or just requestedRoot if set, and its format. If checkIndex
+// is true, the index of a CARv2 is checked against its blocks before use.
+func openCar(printWriter io.Writer, requestedRoot cid.Cid, carPath string, checkIndex bool) (linking.LinkSystem, []cid.Cid, car.Format, *os.File, error) {
 	var err error
 	carPath, err = filepath.Abs(carPath)
 	if err != nil {
-		return block.Block{}, nil, err
+		return linking.LinkSystem{}, nil, car.Format{}, nil, err
 	}
 	carFile, err := os.Open(carPath)
 	if err != nil {
-		return block.Block{}, nil, err
+		return linking.LinkSystem{}, nil, car.Format{}, nil, err
 	}
-	ls, root, err := car.LinkSystem(carFile)
+	ls, roots, format, err := car.LinkSystem(carFile, checkIndex)
 	if err != nil {
-		return block.Block{}, nil, err
+		carFile.Close()
+		return linking.LinkSystem{}, nil, car.Format{}, nil, err
 	}
-	if requestedRoot != cid.Undef && requestedRoot != root {
-		cr := root.String()
-		if root == cid.Undef {
-			cr = "none"
-		}
-		fmt.Fprintf(printWriter, "Requested root CID [%s] does not match CAR file root [%s], proceeding with request\n", requestedRoot.String(), cr)
-		root = requestedRoot
+	switch {
+	case format.IndexStale:
+		fmt.Fprintf(printWriter, "Warning: the %s index of the CARv2 doesn't match its blocks, indexing them afresh\n", format.IndexCodec)
+	case format.Indexed:
+		fmt.Fprintf(printWriter, "Using the %s index of the CARv2\n", format.IndexCodec)
+	case format.Version == 2:
+		fmt.Fprintln(printWriter, "Warning: the CARv2 has no index, indexing its blocks")
+	}
+	if roots, err = resolveRoots(printWriter, roots, requestedRoot); err != nil {
+		carFile.Close()
+		return linking.LinkSystem{}, nil, car.Format{}, nil, err
 	}
-	if root == cid.Undef {
-		return block.Block{}, nil, fmt.Errorf("no root CID specified and CAR file has no root CID")
+	return ls, roots, format, carFile, nil
+}
+
+// openStream is the same as openCar, but reads the CAR as a stream, loading
+// blocks as they arrive rather than via an index. onEarly is called for each
+// block that arrives before it is referenced.
+func openStream(printWriter io.Writer, requestedRoot cid.Cid, r io.Reader, onEarly func(index int, c cid.Cid, wanted cid.Cid)) (linking.LinkSystem, []cid.Cid, *car.Stream, error) {
+	stream, err := car.NewStream(r, onEarly)
+	if err != nil {
+		return linking.LinkSystem{}, nil, nil, err
 	}
-	blk, err := block.NewBlock(ls, root)
+	roots, err := resolveRoots(printWriter, stream.Roots(), requestedRoot)
 	if err != nil {
-		return block.Block{}, nil, err
+		return linking.LinkSystem{}, nil, nil, err
 	}
-	return blk, carFile, nil
+	return stream.LinkSystem(), roots, stream, nil
+}
+
+func resolveRoots(printWriter io.Writer, roots []cid.Cid, requestedRoot cid.Cid) ([]cid.Cid, error) {
+	if requestedRoot == cid.Undef {
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("no root CID specified and CAR file has no root CID")
+		}
+		return roots, nil
+	}
+	for _, root := range roots {
+		if root == requestedRoot {
+			return []cid.Cid{requestedRoot}, nil
+		}
+	}
+	cr := "none"
+	if len(roots) > 0 {
+		strs := make([]string, len(roots))
+		for ii, root := range roots {
+			strs[ii] = root.String()
+		}
+		cr = strings.Join(strs, ", ")
+	}
+	fmt.Fprintf(printWriter, "Requested root CID [%s] does not match CAR file root [%s], proceeding with request\n", requestedRoot.String(), cr)
+	return []cid.Cid{requestedRoot}, nil
 }
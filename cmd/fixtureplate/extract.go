@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipld/go-fixtureplate/block"
+	cli "github.com/urfave/cli/v2"
+)
+
+var extractCommand = &cli.Command{
+	Name: "extract",
+	Usage: "Execute a trustless query across a DAG inside a CAR file and write" +
+		" the blocks a trustless gateway would respond with to a new CAR file",
+	Flags: append([]cli.Flag{carFlag, checkIndexFlag}, queryFlags(
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "CAR file to write to, or - for stdout",
+			Value:   "-",
+		},
+	)...),
+	Action: extractAction,
+}
+
+func extractAction(c *cli.Context) error {
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	root, path, scope, duplicates, byteRange, err := parseQueryFlags(c)
+	if err != nil {
+		return err
+	}
+
+	blk, carFile, err := loadCar(c.Context, c.App.ErrWriter, root, carPath, c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFile.Close()
+
+	fmt.Fprintln(c.App.ErrWriter, block.PrintableQuery(blk.Cid, path, scope, byteRange, duplicates))
+
+	scope, br := entityByteRange(c.App.ErrWriter, scope, byteRange)
+
+	var out io.Writer = c.App.Writer
+	output := c.String("output")
+	if output != "-" {
+		outFile, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	if err := blk.ExtractCAR(c.Context, out, path, scope, br, duplicates); err != nil {
+		return err
+	}
+
+	if output != "-" {
+		fmt.Fprintln(c.App.ErrWriter, "Wrote to", output)
+	}
+	return nil
+}
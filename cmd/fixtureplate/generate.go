@@ -7,22 +7,38 @@ import (
 	"strings"
 
 	"github.com/ipfs/go-cid"
-	"github.com/ipld/go-car/v2"
+	carv2 "github.com/ipld/go-car/v2"
 	storagecar "github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-fixtureplate/car"
 	"github.com/ipld/go-fixtureplate/generator"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
-	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/multiformats/go-multicodec"
 	cli "github.com/urfave/cli/v2"
 )
 
 var generateCommand = &cli.Command{
 	Name:  "generate",
-	Usage: "Generate a synthetic UnixFS DAG for use in testing",
+	Usage: "Generate a synthetic UnixFS or dag-cbor / dag-json DAG for use in testing",
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "spec-file",
+			Usage: "Read the spec from a file rather than the argument; it may" +
+				" define several root entities, one per line",
+		},
 		&cli.Int64Flag{
 			Name:  "seed",
 			Usage: "Seed for the random number generator",
 		},
+		&cli.IntFlag{
+			Name:  "car-version",
+			Usage: "Version of the CAR file to write, 1 or 2",
+			Value: 1,
+		},
+		&cli.StringFlag{
+			Name:  "index",
+			Usage: "Index to include in a CARv2, one of: multihash-sorted, sorted, none",
+			Value: "multihash-sorted",
+		},
 	},
 	ArgsUsage: "<spec>",
 	Action:    generateAction,
@@ -30,23 +46,59 @@ var generateCommand = &cli.Command{
 
 func generateAction(c *cli.Context) error {
 	spec := c.Args().First()
-	if spec == "" {
+	if c.IsSet("spec-file") {
+		byts, err := os.ReadFile(c.String("spec-file"))
+		if err != nil {
+			return err
+		}
+		spec = string(byts)
+	}
+	if strings.TrimSpace(spec) == "" {
 		// "help" becomes a subcommand, clear it to deal with a urfave/cli bug
 		// Ref: https://github.com/urfave/cli/blob/v2.25.7/help.go#L253-L255
 		c.Command.Subcommands = nil
 		cli.ShowCommandHelpAndExit(c, "generate", 0)
 		return nil
 	}
-	entity, err := generator.Parse(spec)
+	var carOpts []carv2.Option
+	switch c.Int("car-version") {
+	case 1:
+		if c.IsSet("index") {
+			return fmt.Errorf("--index is only supported with --car-version=2")
+		}
+	case 2:
+		switch c.String("index") {
+		case "multihash-sorted":
+			carOpts = append(carOpts, carv2.UseIndexCodec(multicodec.CarMultihashIndexSorted))
+		case "sorted":
+			carOpts = append(carOpts, carv2.UseIndexCodec(multicodec.CarIndexSorted))
+		case "none":
+			carOpts = append(carOpts, carv2.WithoutIndex())
+		default:
+			return fmt.Errorf("unknown index: %s", c.String("index"))
+		}
+	default:
+		return fmt.Errorf("unsupported CAR version: %d", c.Int("car-version"))
+	}
+
+	entities, err := generator.ParseRoots(spec)
 	if err != nil {
 		if err, ok := err.(generator.ErrParse); ok {
-			// move in enough spaces to point to err.Pos on the line above
-			fmt.Printf("Input spec: %s\n", spec)
-			fmt.Printf("            %s^\n", strings.Repeat(" ", err.Pos))
+			// show the line of the spec with the error, and move in enough spaces
+			// to point to err.Pos on the line above
+			start := strings.LastIndex(spec[:err.Pos], "\n") + 1
+			line, _, _ := strings.Cut(spec[start:], "\n")
+			fmt.Printf("Input spec: %s\n", line)
+			fmt.Printf("            %s^\n", strings.Repeat(" ", err.Pos-start))
 		}
 		return err
 	}
-	fmt.Println(entity.Describe(""))
+	for ii, entity := range entities {
+		if len(entities) > 1 {
+			fmt.Printf("Root %d: ", ii+1)
+		}
+		fmt.Println(entity.Describe(""))
+	}
 
 	outf, err := os.CreateTemp("", "fixtureplate-*.car")
 	if err != nil {
@@ -57,7 +109,7 @@ func generateAction(c *cli.Context) error {
 		os.Remove(outf.Name())
 	}()
 
-	storage, err := storagecar.NewReadableWritable(outf, []cid.Cid{}, car.WriteAsCarV1(true))
+	storage, err := storagecar.NewReadableWritable(outf, []cid.Cid{}, carv2.WriteAsCarV1(true))
 	if err != nil {
 		return err
 	}
@@ -69,25 +121,24 @@ func generateAction(c *cli.Context) error {
 	seed := c.Int64("seed")
 	rand := rand.New(rand.NewSource(seed))
 
-	rootEnt, err := entity.Generate(lsys, rand)
-	if err != nil {
-		return err
+	roots := make([]cid.Cid, 0, len(entities))
+	for _, entity := range entities {
+		rootEnt, err := entity.Generate(lsys, rand)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, rootEnt.Root)
 	}
 
-	outFile := rootEnt.Root.String() + ".car"
-	out, err := os.Create(outFile)
-	if err != nil {
+	// a CAR with multiple roots is named after the first
+	outFile := roots[0].String() + ".car"
+	if err := car.WriteRoots(c.Context, lsys, roots, outFile, c.Int("car-version") == 2, carOpts...); err != nil {
 		return err
 	}
-	defer out.Close()
-	if _, err := car.TraverseV1(
-		c.Context,
-		&lsys,
-		rootEnt.Root,
-		selectorparse.CommonSelector_ExploreAllRecursively,
-		out,
-	); err != nil {
-		return err
+	if len(roots) > 1 {
+		for ii, root := range roots {
+			fmt.Printf("Root %d: %s\n", ii+1, root)
+		}
 	}
 
 	fmt.Println("Wrote to", outFile)
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
 
 	cli "github.com/urfave/cli/v2"
 
 	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
 )
 
 func main() {
@@ -14,12 +17,23 @@ func main() {
 		Name:  "fixtureplate",
 		Usage: "Work with, and inspect IPLD DAGs",
 		Commands: []*cli.Command{
+			diffCommand,
 			explainCommand,
+			extractCommand,
+			verifyCommand,
 			generateCommand,
+			statsCommand,
+			orphansCommand,
+			orderCheckCommand,
+			unpackCommand,
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	// cancel any traversal in progress on interrupt
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := app.RunContext(ctx, os.Args)
+	cancel()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
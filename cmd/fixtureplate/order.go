@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-fixtureplate/car"
+	cli "github.com/urfave/cli/v2"
+)
+
+var orderCheckCommand = &cli.Command{
+	Name: "order-check",
+	Usage: "Read the blocks of a CAR file in sequence and check that they are" +
+		" in traversal order, as streaming verifiers require",
+	Flags: []cli.Flag{
+		carFlag,
+		checkIndexFlag,
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Override the root CID of the CAR file",
+		},
+		&cli.StringFlag{
+			Name: "order",
+			Usage: "Traversal order to check against, one of: dfs (as a trustless" +
+				" gateway responds with), bfs, or unknown to detect which, if any," +
+				" of them the CAR is in",
+			Value: string(block.OrderDFS),
+		},
+	},
+	ArgsUsage: "<car>",
+	Action:    orderCheckAction,
+}
+
+func orderCheckAction(c *cli.Context) error {
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	var root cid.Cid
+	if c.IsSet("root") {
+		if root, err = cid.Parse(c.String("root")); err != nil {
+			return err
+		}
+	}
+
+	var orders []block.TraversalOrder
+	switch order := c.String("order"); order {
+	case string(block.OrderDFS), string(block.OrderBFS):
+		orders = []block.TraversalOrder{block.TraversalOrder(order)}
+	case "unknown":
+		orders = []block.TraversalOrder{block.OrderDFS, block.OrderBFS}
+	default:
+		return fmt.Errorf("unknown order: %s", order)
+	}
+
+	blk, carFile, err := loadCar(c.Context, c.App.ErrWriter, root, carPath, c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFile.Close()
+
+	// read in sequence rather than via the index, as a streaming reader would
+	cids, err := car.Cids(carFile)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, order := range orders {
+		err := blk.CheckOrder(c.Context, cids, order)
+		var orderErr block.ErrBlockOrder
+		if errors.As(err, &orderErr) {
+			errs = append(errs, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "%s are in %s order from %s\n", plural(len(cids), "block", "blocks"), order, blk.Cid)
+		return nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-fixtureplate/car"
+	"github.com/multiformats/go-multicodec"
+	cli "github.com/urfave/cli/v2"
+)
+
+var orphansCommand = &cli.Command{
+	Name: "orphans",
+	Usage: "List the blocks in a CAR file that aren't reachable from the root," +
+		" and optionally write a copy of the CAR without them",
+	Flags: []cli.Flag{
+		carFlag,
+		checkIndexFlag,
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Override the root CID of the CAR file",
+		},
+		&cli.StringFlag{
+			Name: "prune",
+			Usage: "CAR file to write the reachable blocks to, in their original" +
+				" order, or - for stdout",
+		},
+	},
+	ArgsUsage: "<car>",
+	Action:    orphansAction,
+}
+
+func orphansAction(c *cli.Context) error {
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	var root cid.Cid
+	if c.IsSet("root") {
+		if root, err = cid.Parse(c.String("root")); err != nil {
+			return err
+		}
+	}
+
+	blk, carFile, err := loadCar(c.Context, c.App.ErrWriter, root, carPath, c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFile.Close()
+
+	cids, err := car.Cids(carFile)
+	if err != nil {
+		return err
+	}
+
+	// the listing goes to stderr if the pruned CAR is written to stdout
+	info := c.App.Writer
+	prune := c.String("prune")
+	if prune == "-" {
+		info = c.App.ErrWriter
+	}
+
+	// the DAG is walked once, for both the listing and pruning
+	reachable, err := blk.Reachable(c.Context)
+	if err != nil {
+		return err
+	}
+	orphans, err := blk.Orphans(c.Context, reachable, cids)
+	if err != nil {
+		return err
+	}
+	for _, o := range orphans {
+		if o.DataType == block.DataType_Invalid {
+			fmt.Fprintf(info, "%s | %s %s\n", o.Cid, o.DataTypeString(), multicodec.Code(o.Cid.Prefix().Codec))
+			continue
+		}
+		fmt.Fprintf(info, "%s | %s\n", o.Cid, o.DataTypeString())
+	}
+	fmt.Fprintf(info, "%s of %s unreachable from %s\n", plural(len(orphans), "block", "blocks"), plural(len(cids), "block", "blocks"), blk.Cid)
+
+	if prune == "" {
+		return nil
+	}
+	var out io.Writer = c.App.Writer
+	if prune != "-" {
+		outFile, err := os.Create(prune)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	if _, err := blk.PruneCAR(c.Context, out, reachable, cids); err != nil {
+		return err
+	}
+	if prune != "-" {
+		fmt.Fprintln(info, "Wrote to", prune)
+	}
+	return nil
+}
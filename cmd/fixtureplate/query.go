@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	cli "github.com/urfave/cli/v2"
+)
+
+var carFlag = &cli.StringFlag{
+	Name:  "car",
+	Usage: "CAR file to read from, if not supplied, the first unnamed argument will be used",
+}
+
+var checkIndexFlag = &cli.BoolFlag{
+	Name: "check-index",
+	Usage: "Check the index of a CARv2 against its blocks, which reads the" +
+		" whole file, and index the blocks afresh if it is stale",
+}
+
+// carPathArg reads the path of the CAR file from --car or the first argument.
+func carPathArg(c *cli.Context) (string, error) {
+	if c.String("car") != "" {
+		return c.String("car"), nil
+	}
+	if c.Args().Len() > 0 {
+		return c.Args().First(), nil
+	}
+	return "", fmt.Errorf("no CAR file specified")
+}
+
+// queryFlags are the flags common to commands that execute a trustless query,
+// followed by any extra flags for the command.
+func queryFlags(extra ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Override the root CID of the CAR file or query",
+		},
+		&cli.StringFlag{
+			Name:        "path",
+			Usage:       "Path to query, required unless --query is specified",
+			DefaultText: "/",
+		},
+		&cli.StringFlag{
+			Name:        "scope",
+			Aliases:     []string{"dag-scope"},
+			DefaultText: "all",
+			Usage:       "Scope of the query, one of: all, entity, block",
+		},
+		&cli.StringFlag{
+			Name:    "bytes",
+			Aliases: []string{"entity-bytes"},
+			Value:   "",
+			Usage: "Byte range of the terminating entity if that entity is a" +
+				" sharded file of the form `from:to`, where * is a valid `to`" +
+				" value and negative `to` values are also valid",
+		},
+		&cli.BoolFlag{
+			Name:        "duplicates",
+			Aliases:     []string{"dups"},
+			DefaultText: "true",
+			Usage:       "Include duplicate blocks in the output",
+		},
+		&cli.StringFlag{
+			Name: "query",
+			Usage: "Full query (e.g. /ipfs/bafy.../path?dag-scope=all&dups=n&byte-range=0:*)" +
+				" (will be overridden by --path, --scope, --bytes and --duplicates," +
+				" if set; note that this is not strictly a trustless query as it" +
+				" incorporates elements, such as 'dups', that are normally included" +
+				" in the Accept header)",
+		},
+	}, extra...)
+}
+
+// parseQueryFlags reads the query from the queryFlags, the individual flags
+// taking precedence over the components of --query.
+func parseQueryFlags(c *cli.Context) (
+	root cid.Cid,
+	path datamodel.Path,
+	scope trustlessutils.DagScope,
+	duplicates bool,
+	byteRange *trustlessutils.ByteRange,
+	err error,
+) {
+	path = datamodel.Path{}
+	scope = trustlessutils.DagScopeAll
+	duplicates = true
+
+	if c.IsSet("query") {
+		if root, path, scope, duplicates, byteRange, err = block.ParseQuery(c.String("query")); err != nil {
+			return
+		}
+	}
+
+	if c.IsSet("path") {
+		path = datamodel.ParsePath(c.String("path"))
+	}
+
+	if c.IsSet("root") {
+		if root, err = cid.Parse(c.String("root")); err != nil {
+			return
+		}
+	}
+
+	if c.IsSet("scope") {
+		if scope, err = trustlessutils.ParseDagScope(c.String("scope")); err != nil {
+			return
+		}
+	}
+
+	if c.IsSet("bytes") {
+		var br trustlessutils.ByteRange
+		if br, err = trustlessutils.ParseByteRange(c.String("bytes")); err != nil {
+			return
+		}
+		byteRange = &br
+	}
+
+	if c.IsSet("duplicates") {
+		duplicates = c.Bool("duplicates")
+	}
+	return
+}
+
+// entityByteRange switches the query to entity scope if a byte range is
+// supplied, as a byte range only applies to an entity, and otherwise returns
+// the default, full, byte range.
+func entityByteRange(
+	w io.Writer,
+	scope trustlessutils.DagScope,
+	byteRange *trustlessutils.ByteRange,
+) (trustlessutils.DagScope, trustlessutils.ByteRange) {
+	if byteRange == nil {
+		br, _ := trustlessutils.ParseByteRange("")
+		return scope, br
+	}
+	if scope != trustlessutils.DagScopeEntity {
+		fmt.Fprintf(w, "WARNING: byte range specified, but scope is not entity, switching to entity scope\n")
+		scope = trustlessutils.DagScopeEntity
+	}
+	return scope, *byteRange
+}
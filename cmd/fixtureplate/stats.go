@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	"github.com/ipld/go-fixtureplate/car"
+	cli "github.com/urfave/cli/v2"
+)
+
+var statsCommand = &cli.Command{
+	Name:  "stats",
+	Usage: "Show statistics about the blocks and UnixFS entities of a DAG inside a CAR file",
+	Flags: []cli.Flag{
+		carFlag,
+		checkIndexFlag,
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Override the root CID of the CAR file",
+		},
+	},
+	ArgsUsage: "<car>",
+	Action:    statsAction,
+}
+
+func statsAction(c *cli.Context) error {
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	var root cid.Cid
+	if c.IsSet("root") {
+		if root, err = cid.Parse(c.String("root")); err != nil {
+			return err
+		}
+	}
+
+	ls, roots, format, carFile, err := openCar(c.App.ErrWriter, root, carPath, c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFile.Close()
+	blk, err := loadRoot(c.Context, ls, roots)
+	if err != nil {
+		return err
+	}
+
+	stats, err := block.CollectStats(c.Context, blk)
+	if err != nil {
+		return err
+	}
+	cids, err := car.Cids(carFile)
+	if err != nil {
+		return err
+	}
+	unreachable := stats.Unreachable(cids)
+
+	w := c.App.Writer
+	fmt.Fprintf(w, "Root: %s\n", blk.Cid)
+	fmt.Fprintf(w, "Format: %s\n", format)
+	fmt.Fprintf(w, "Blocks: %s (%s)\n", humanize.Comma(int64(stats.Blocks)), humanize.Bytes(uint64(stats.Bytes)))
+	fmt.Fprintln(w, "  By codec:")
+	for _, k := range sortedCounts(stats.ByCodec) {
+		fmt.Fprintf(w, "    %-12s %s\n", k, humanize.Comma(int64(stats.ByCodec[k])))
+	}
+	fmt.Fprintln(w, "  By data type:")
+	for _, k := range sortedCounts(stats.ByDataType) {
+		fmt.Fprintf(w, "    %-12s %s\n", k, humanize.Comma(int64(stats.ByDataType[k])))
+	}
+	fmt.Fprintf(w, "Duplicate blocks: %s (%s saved by deduplication)\n", humanize.Comma(int64(stats.Duplicates)), humanize.Bytes(uint64(stats.DedupBytes)))
+	fmt.Fprintf(w, "Missing blocks: %s\n", humanize.Comma(int64(stats.Missing)))
+	fmt.Fprintf(w, "Unreachable blocks: %s\n", humanize.Comma(int64(len(unreachable))))
+	fmt.Fprintf(w, "Max DAG depth: %d\n", stats.MaxDepth)
+	fmt.Fprintf(w, "Max HAMT depth: %d\n", stats.MaxHamtDepth)
+	fmt.Fprintln(w, "Files:")
+	stats.FileSizes.Write(w, "  ", true)
+	fmt.Fprintln(w, "Leaf sizes:")
+	stats.LeafSizes.Write(w, "  ", true)
+	fmt.Fprintln(w, "Directory fan-out:")
+	stats.DirFanout.Write(w, "  ", false)
+	return nil
+}
+
+// sortedCounts returns the keys of a count map ordered by descending count,
+// then name.
+func sortedCounts(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cli "github.com/urfave/cli/v2"
+)
+
+var unpackCommand = &cli.Command{
+	Name: "unpack",
+	Usage: "Write the UnixFS files, directories and symlinks of a DAG inside a" +
+		" CAR file to a directory",
+	Flags: []cli.Flag{
+		carFlag,
+		checkIndexFlag,
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Override the root CID of the CAR file",
+		},
+		&cli.StringFlag{
+			Name:        "path",
+			Usage:       "Path to unpack, only the entries along it are written above its terminus",
+			DefaultText: "/",
+		},
+		&cli.StringFlag{
+			Name:     "output",
+			Aliases:  []string{"o"},
+			Usage:    "Directory to write to, created if it doesn't exist",
+			Required: true,
+		},
+	},
+	ArgsUsage: "<car>",
+	Action:    unpackAction,
+}
+
+func unpackAction(c *cli.Context) error {
+	carPath, err := carPathArg(c)
+	if err != nil {
+		return err
+	}
+	var root cid.Cid
+	if c.IsSet("root") {
+		if root, err = cid.Parse(c.String("root")); err != nil {
+			return err
+		}
+	}
+	path := datamodel.ParsePath(c.String("path"))
+
+	blk, carFile, err := loadCar(c.Context, c.App.ErrWriter, root, carPath, c.Bool("check-index"))
+	if err != nil {
+		return err
+	}
+	defer carFile.Close()
+
+	output := c.String("output")
+	if err := os.MkdirAll(output, 0o755); err != nil {
+		return err
+	}
+	if err := blk.Unpack(c.Context, path, output); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.ErrWriter, "Unpacked", blk.Cid, "to", output)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-fixtureplate/block"
+	cli "github.com/urfave/cli/v2"
+)
+
+var verifyCommand = &cli.Command{
+	Name: "verify",
+	Usage: "Check that a CAR file received from a trustless gateway is the" +
+		" correct response for a query",
+	Flags: queryFlags(
+		checkIndexFlag,
+		&cli.StringFlag{
+			Name:     "response",
+			Usage:    "CAR file received in response to the query",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name: "source",
+			Usage: "CAR file containing the full DAG to check the response against;" +
+				" if not supplied, the query is navigated over the blocks of the" +
+				" response itself",
+		},
+	),
+	Action: verifyAction,
+}
+
+func verifyAction(c *cli.Context) error {
+	root, path, scope, duplicates, byteRange, err := parseQueryFlags(c)
+	if err != nil {
+		return err
+	}
+
+	var source block.Block
+	if c.IsSet("source") {
+		var carFile *os.File
+		if source, carFile, err = loadCar(c.Context, c.App.ErrWriter, root, c.String("source"), c.Bool("check-index")); err != nil {
+			return err
+		}
+		defer carFile.Close()
+		root = source.Cid
+	} else if root == cid.Undef {
+		return fmt.Errorf("no root CID specified, use --query or --root")
+	}
+
+	fmt.Fprintln(c.App.Writer, block.PrintableQuery(root, path, scope, byteRange, duplicates))
+	scope, br := entityByteRange(c.App.ErrWriter, scope, byteRange)
+
+	response, err := os.Open(c.String("response"))
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	if c.IsSet("source") {
+		err = source.VerifyResponse(c.Context, response, path, scope, br, duplicates)
+	} else {
+		err = block.VerifyResponse(c.Context, response, root, path, scope, br, duplicates)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, "Response matches query")
+	return nil
+}
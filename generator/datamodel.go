@@ -0,0 +1,535 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	unixfstestutil "github.com/ipfs/go-unixfsnode/testutil"
+	"github.com/ipfs/go-unixfsnode/testutil/namegen"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	trustlesstestutil "github.com/ipld/go-trustless-utils/testutil"
+	"github.com/multiformats/go-multihash"
+
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
+)
+
+// Codec is the IPLD codec used to encode a Map or List block.
+type Codec string
+
+const (
+	Codec_DagCbor Codec = "dag-cbor"
+	Codec_DagJson Codec = "dag-json"
+)
+
+func (c Codec) multicodec() uint64 {
+	if c == Codec_DagJson {
+		return cid.DagJSON
+	}
+	return cid.DagCBOR
+}
+
+var _ Entity = Map{}
+var _ Entity = List{}
+var _ Entity = Scalar{}
+var _ Entity = Bytes{}
+
+// value is implemented by entities that are encoded inline within a parent
+// Map or List rather than being linked to as a separate block.
+type value interface {
+	node(rndReader io.Reader) (datamodel.Node, error)
+}
+
+// Map is a non-UnixFS IPLD map, encoded as its own block. Children that are
+// scalars or bytes are encoded inline, all other children are linked. Each
+// child is keyed by its name, or a random name if it doesn't have one.
+type Map struct {
+	Codec            Codec
+	Name             string
+	Multiplier       int
+	RandomMultiplier bool
+	Children         []Entity
+}
+
+func (m Map) GetName() string {
+	return m.Name
+}
+
+func (m Map) GetMultiplier() int {
+	return m.Multiplier
+}
+
+func (m Map) IsRandomMultiplier() bool {
+	return m.RandomMultiplier
+}
+
+func (m Map) String() string {
+	return nodeString("map", m.Codec, m.Multiplier, m.RandomMultiplier, m.Children)
+}
+
+func (m Map) Describe(indent string) string {
+	return nodeDescribe(indent, "map", m.Codec, m.Name, m.Multiplier, m.RandomMultiplier, m.Children)
+}
+
+func (m Map) Generate(lsys linking.LinkSystem, rndReader io.Reader) (unixfstestutil.DirEntry, error) {
+	children := expandChildren(m.Children, rndReader)
+	names := make([]string, len(children))
+	seen := make(map[string]struct{})
+	for _, child := range children {
+		if child.GetName() != "" {
+			seen[child.GetName()] = struct{}{}
+		}
+	}
+	for ii, child := range children {
+		if child.GetName() != "" {
+			names[ii] = child.GetName()
+			continue
+		}
+		for {
+			name, err := namegen.RandomDirectoryName(rndReader)
+			if err != nil {
+				return unixfstestutil.DirEntry{}, err
+			}
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names[ii] = name
+				break
+			}
+		}
+	}
+
+	values, entries, err := generateValues(children, lsys, rndReader)
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	node, err := qp.BuildMap(basicnode.Prototype.Any, int64(len(values)), func(ma datamodel.MapAssembler) {
+		for ii, v := range values {
+			qp.MapEntry(ma, names[ii], qp.Node(v))
+		}
+	})
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	for ii := range entries {
+		entries[ii].Path = names[ii]
+	}
+	return storeNode(lsys, m.Codec, node, compactEntries(entries))
+}
+
+// List is a non-UnixFS IPLD list, encoded as its own block. Children that are
+// scalars or bytes are encoded inline, all other children are linked.
+type List struct {
+	Codec            Codec
+	Name             string
+	Multiplier       int
+	RandomMultiplier bool
+	Children         []Entity
+}
+
+func (l List) GetName() string {
+	return l.Name
+}
+
+func (l List) GetMultiplier() int {
+	return l.Multiplier
+}
+
+func (l List) IsRandomMultiplier() bool {
+	return l.RandomMultiplier
+}
+
+func (l List) String() string {
+	return nodeString("list", l.Codec, l.Multiplier, l.RandomMultiplier, l.Children)
+}
+
+func (l List) Describe(indent string) string {
+	return nodeDescribe(indent, "list", l.Codec, l.Name, l.Multiplier, l.RandomMultiplier, l.Children)
+}
+
+func (l List) Generate(lsys linking.LinkSystem, rndReader io.Reader) (unixfstestutil.DirEntry, error) {
+	children := expandChildren(l.Children, rndReader)
+	values, entries, err := generateValues(children, lsys, rndReader)
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	node, err := qp.BuildList(basicnode.Prototype.Any, int64(len(values)), func(la datamodel.ListAssembler) {
+		for _, v := range values {
+			qp.ListEntry(la, qp.Node(v))
+		}
+	})
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	for ii := range entries {
+		entries[ii].Path = strconv.Itoa(ii)
+	}
+	return storeNode(lsys, l.Codec, node, compactEntries(entries))
+}
+
+// Scalar is an inline int, float, string, bool or null value within a Map or
+// List.
+type Scalar struct {
+	Kind             datamodel.Kind // Kind_Int, Kind_Float, Kind_String, Kind_Bool or Kind_Null
+	Value            any            // int64, float64, string, bool or nil, matching Kind
+	Name             string
+	Multiplier       int
+	RandomMultiplier bool
+}
+
+func (s Scalar) GetName() string {
+	return s.Name
+}
+
+func (s Scalar) GetMultiplier() int {
+	return s.Multiplier
+}
+
+func (s Scalar) IsRandomMultiplier() bool {
+	return s.RandomMultiplier
+}
+
+func (s Scalar) typeName() string {
+	switch s.Kind {
+	case datamodel.Kind_Int:
+		return "int"
+	case datamodel.Kind_Float:
+		return "float"
+	case datamodel.Kind_String:
+		return "string"
+	case datamodel.Kind_Bool:
+		return "bool"
+	}
+	return "null"
+}
+
+func (s Scalar) valueString() string {
+	switch v := s.Value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return `"` + v + `"`
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func (s Scalar) String() string {
+	var sb strings.Builder
+	writeMultiplier(&sb, s.Multiplier, s.RandomMultiplier)
+	sb.WriteString(s.typeName())
+	if s.Kind != datamodel.Kind_Null {
+		sb.WriteRune(':')
+		sb.WriteString(s.valueString())
+	}
+	return sb.String()
+}
+
+func (s Scalar) Describe(indent string) string {
+	var sb strings.Builder
+	writeCount(&sb, indent, s.Multiplier, s.RandomMultiplier, s.typeName(), s.typeName()+"s")
+	if s.Name != "" {
+		sb.WriteString(` named "`)
+		sb.WriteString(s.Name)
+		sb.WriteRune('"')
+	}
+	if s.Kind != datamodel.Kind_Null {
+		sb.WriteString(" with value ")
+		sb.WriteString(s.valueString())
+	}
+	return sb.String()
+}
+
+func (s Scalar) node(rndReader io.Reader) (datamodel.Node, error) {
+	switch v := s.Value.(type) {
+	case int64:
+		return basicnode.NewInt(v), nil
+	case float64:
+		return basicnode.NewFloat(v), nil
+	case string:
+		return basicnode.NewString(v), nil
+	case bool:
+		return basicnode.NewBool(v), nil
+	}
+	return datamodel.Null, nil
+}
+
+// Generate encodes this scalar as a standalone dag-cbor block. Scalars are
+// normally encoded inline within a Map or List.
+func (s Scalar) Generate(lsys linking.LinkSystem, rndReader io.Reader) (unixfstestutil.DirEntry, error) {
+	node, err := s.node(rndReader)
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	return storeNode(lsys, Codec_DagCbor, node, nil)
+}
+
+// Bytes is an inline bytes value within a Map or List, filled with random
+// bytes, or zeros.
+type Bytes struct {
+	Name             string
+	Size             uint64
+	RandomSize       bool
+	ZeroContent      bool
+	Multiplier       int
+	RandomMultiplier bool
+}
+
+func (b Bytes) GetName() string {
+	return b.Name
+}
+
+func (b Bytes) GetMultiplier() int {
+	return b.Multiplier
+}
+
+func (b Bytes) IsRandomMultiplier() bool {
+	return b.RandomMultiplier
+}
+
+func (b Bytes) String() string {
+	var sb strings.Builder
+	writeMultiplier(&sb, b.Multiplier, b.RandomMultiplier)
+	sb.WriteString("bytes:")
+	if b.RandomSize {
+		sb.WriteRune('~')
+	}
+	sb.WriteString(strings.ReplaceAll(humanize.Bytes(uint64(b.Size)), " ", ""))
+	if b.ZeroContent {
+		sb.WriteString("{zero}")
+	}
+	return sb.String()
+}
+
+func (b Bytes) Describe(indent string) string {
+	var sb strings.Builder
+	writeCount(&sb, indent, b.Multiplier, b.RandomMultiplier, "bytes value", "bytes values")
+	if b.Name != "" {
+		sb.WriteString(` named "`)
+		sb.WriteString(b.Name)
+		sb.WriteRune('"')
+	}
+	sb.WriteString(" of ")
+	if b.RandomSize {
+		sb.WriteString("approximately ")
+	}
+	if b.Size%1024 == 0 {
+		sb.WriteString(humanize.IBytes(uint64(b.Size)))
+	} else {
+		sb.WriteString(humanize.Bytes(uint64(b.Size)))
+	}
+	if b.ZeroContent {
+		sb.WriteString(" containing just zeros")
+	}
+	return sb.String()
+}
+
+func (b Bytes) node(rndReader io.Reader) (datamodel.Node, error) {
+	if b.ZeroContent {
+		rndReader = trustlesstestutil.ZeroReader{}
+	}
+	size := int(b.Size)
+	if b.RandomSize {
+		for {
+			size = randNormInt(rndReader, size)
+			if size >= 0 {
+				break
+			}
+		}
+	}
+	byts := make([]byte, size)
+	if _, err := io.ReadFull(rndReader, byts); err != nil {
+		return nil, err
+	}
+	return basicnode.NewBytes(byts), nil
+}
+
+// Generate encodes this bytes value as a standalone dag-cbor block. Bytes are
+// normally encoded inline within a Map or List.
+func (b Bytes) Generate(lsys linking.LinkSystem, rndReader io.Reader) (unixfstestutil.DirEntry, error) {
+	node, err := b.node(rndReader)
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	return storeNode(lsys, Codec_DagCbor, node, nil)
+}
+
+// generateValues produces a node for each of the children, in order. Inline
+// values are built directly, all other entities are generated as their own
+// DAGs and represented as a link. The returned DirEntry slice is parallel to
+// the children, with a zero DirEntry for inline values.
+func generateValues(
+	children []Entity,
+	lsys linking.LinkSystem,
+	rndReader io.Reader,
+) ([]datamodel.Node, []unixfstestutil.DirEntry, error) {
+	values := make([]datamodel.Node, len(children))
+	entries := make([]unixfstestutil.DirEntry, len(children))
+	for ii, child := range children {
+		if v, ok := child.(value); ok {
+			node, err := v.node(rndReader)
+			if err != nil {
+				return nil, nil, err
+			}
+			values[ii] = node
+			continue
+		}
+		de, err := child.Generate(lsys, rndReader)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[ii] = basicnode.NewLink(cidlink.Link{Cid: de.Root})
+		entries[ii] = de
+	}
+	return values, entries, nil
+}
+
+// compactEntries removes the zero DirEntry placeholders for inline values.
+func compactEntries(entries []unixfstestutil.DirEntry) []unixfstestutil.DirEntry {
+	linked := make([]unixfstestutil.DirEntry, 0, len(entries))
+	for _, de := range entries {
+		if de.Root != cid.Undef {
+			linked = append(linked, de)
+		}
+	}
+	return linked
+}
+
+// storeNode encodes the node with the given codec, writes it to the
+// LinkSystem and returns a DirEntry for it with the linked children.
+func storeNode(
+	lsys linking.LinkSystem,
+	codec Codec,
+	node datamodel.Node,
+	children []unixfstestutil.DirEntry,
+) (unixfstestutil.DirEntry, error) {
+	c, tsize, err := storeBlock(lsys, codec.multicodec(), node)
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	for _, child := range children {
+		tsize += child.TSize
+	}
+	return unixfstestutil.DirEntry{
+		Root:     c,
+		SelfCids: []cid.Cid{c},
+		TSize:    tsize,
+		Children: children,
+	}, nil
+}
+
+// storeBlock encodes node with the given codec as a CIDv1 sha2-256 block and
+// stores it, returning the CID and the size of the encoded block.
+func storeBlock(lsys linking.LinkSystem, codec uint64, node datamodel.Node) (cid.Cid, uint64, error) {
+	lp := cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    codec,
+		MhType:   multihash.SHA2_256,
+		MhLength: -1,
+	}}
+	encoder, err := lsys.EncoderChooser(lp)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	var buf bytes.Buffer
+	if err := encoder(node, &buf); err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := lp.Prefix.Sum(buf.Bytes())
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	w, commit, err := lsys.StorageWriteOpener(linking.LinkContext{})
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return cid.Undef, 0, err
+	}
+	if err := commit(cidlink.Link{Cid: c}); err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, uint64(buf.Len()), nil
+}
+
+func nodeString(typ string, codec Codec, multiplier int, rnd bool, children []Entity) string {
+	var sb strings.Builder
+	writeMultiplier(&sb, multiplier, rnd)
+	sb.WriteString(typ)
+	if codec != "" && codec != Codec_DagCbor {
+		sb.WriteString(fmt.Sprintf("{codec:%s}", codec))
+	}
+	sb.WriteRune('(')
+	for i, c := range children {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(c.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func nodeDescribe(indent, typ string, codec Codec, name string, multiplier int, rnd bool, children []Entity) string {
+	if codec == "" {
+		codec = Codec_DagCbor
+	}
+	var sb strings.Builder
+	writeCount(&sb, indent, multiplier, rnd, string(codec)+" "+typ, string(codec)+" "+typ+"s")
+	if name != "" {
+		sb.WriteString(` named "`)
+		sb.WriteString(name)
+		sb.WriteRune('"')
+	}
+	sb.WriteString(" containing:")
+	for _, c := range children {
+		sb.WriteString("\n")
+		sb.WriteString(c.Describe(indent + "  "))
+	}
+	return sb.String()
+}
+
+func writeMultiplier(sb *strings.Builder, multiplier int, rnd bool) {
+	if rnd {
+		sb.WriteRune('~')
+	}
+	if rnd || multiplier > 1 {
+		sb.WriteString(fmt.Sprintf("%d*", multiplier))
+	}
+}
+
+// writeCount writes the leading "A thing", "An other thing", "5 things" or
+// "Approximately 5 things" portion of a description.
+func writeCount(sb *strings.Builder, indent string, multiplier int, rnd bool, singular, plural string) {
+	if indent != "" {
+		sb.WriteString(indent)
+		sb.WriteString("→ ")
+	}
+	if rnd {
+		sb.WriteString("Approximately ")
+		sb.WriteString(fmt.Sprintf("%d", multiplier))
+	} else if multiplier > 1 {
+		sb.WriteString(fmt.Sprintf("%d", multiplier))
+	} else if strings.ContainsRune("aeiou", rune(singular[0])) {
+		sb.WriteString("An")
+	} else {
+		sb.WriteString("A")
+	}
+	sb.WriteRune(' ')
+	if multiplier > 1 {
+		sb.WriteString(plural)
+	} else {
+		sb.WriteString(singular)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"unicode"
 
 	"github.com/dustin/go-humanize"
+	"github.com/ipld/go-ipld-prime/datamodel"
 )
 
 type ErrParse struct {
@@ -40,13 +41,58 @@ func Parse(str string) (Entity, error) {
 	if strings.TrimSpace(p.str[p.pos:]) != "" {
 		return nil, errors.New("unexpected trailing characters")
 	}
+	if err := checkRoot(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ParseRoots parses one or more independent root entities, separated by commas
+// or newlines, such as a spec file with one root per line. Each root is subject
+// to the same rules as the single root entity of Parse.
+func ParseRoots(str string) ([]Entity, error) {
+	p := &parser{str: str}
+	roots := make([]Entity, 0)
+	p.slurpSpace()
+	for p.hasMore() {
+		start := p.pos
+		e, err := p.parseEntity()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRoot(e); err != nil {
+			return nil, ErrParse{Pos: start, Err: err}
+		}
+		roots = append(roots, e)
+		newline := p.slurpSpace()
+		if !p.hasMore() {
+			break
+		}
+		if comma, err := p.slurpComma(); err != nil {
+			return nil, err
+		} else if !comma && !newline {
+			return nil, p.newParseError("expected ',' or newline between root entities")
+		}
+		p.slurpSpace()
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no root entities")
+	}
+	return roots, nil
+}
+
+func checkRoot(e Entity) error {
 	if e.GetMultiplier() != 1 || e.IsRandomMultiplier() {
-		return nil, errors.New("root entity must be strictly signular")
+		return errors.New("root entity must be strictly signular")
 	}
 	if e.GetName() != "" {
-		return nil, errors.New("root entity can't be named")
+		return errors.New("root entity can't be named")
 	}
-	return e, nil
+	switch e.(type) {
+	case Scalar, Bytes:
+		return errors.New("root entity must be a file, dir, map or list")
+	}
+	return nil
 }
 
 type parser struct {
@@ -91,6 +137,12 @@ func (p *parser) parseEntity() (Entity, error) {
 		entity, err = p.parseFile(multiplier, rnd)
 	case "dir":
 		entity, err = p.parseDir(multiplier, rnd)
+	case "map", "list":
+		entity, err = p.parseNode(typ, multiplier, rnd)
+	case "bytes":
+		entity, err = p.parseBytes(multiplier, rnd)
+	default:
+		entity, err = p.parseScalar(typ, multiplier, rnd)
 	}
 	if err != nil {
 		return nil, err
@@ -104,20 +156,25 @@ func (p *parser) parseFile(multiplier int, rnd bool) (Entity, error) {
 	if err != nil {
 		return nil, err
 	}
-	name, zero, err := p.slurpFileOptions()
+	opts, err := p.slurpFileOptions(true)
 	if err != nil {
 		return nil, err
 	}
-	if name != "" && (multiplier > 1 || rnd) {
+	if opts.name != "" && (multiplier > 1 || rnd) {
 		return nil, p.newParseError("file with a multiplier can't be named")
 	}
 	return File{
-		Name:             name,
+		Name:             opts.name,
 		Multiplier:       multiplier,
 		RandomMultiplier: rnd,
 		Size:             size,
 		RandomSize:       rndSize,
-		ZeroContent:      zero,
+		ZeroContent:      opts.zero,
+		ChunkSize:        opts.chunkSize,
+		Fanout:           opts.fanout,
+		Layout:           opts.layout,
+		Leaves:           opts.leaves,
+		InlineSize:       opts.inline,
 	}, nil
 }
 
@@ -149,6 +206,11 @@ func (p *parser) parseDir(multiplier int, rnd bool) (Entity, error) {
 		if err != nil {
 			return nil, err
 		}
+		switch entity.(type) {
+		case File, Directory:
+		default:
+			return nil, p.newParseError("directory can only contain files and directories")
+		}
 		dir.Children = append(dir.Children, entity)
 		if comma, err := p.slurpComma(); err != nil {
 			return nil, err
@@ -162,40 +224,189 @@ func (p *parser) parseDir(multiplier int, rnd bool) (Entity, error) {
 	return dir, nil
 }
 
+func (p *parser) parseNode(typ string, multiplier int, rnd bool) (Entity, error) {
+	name, codec, err := p.slurpNodeOptions()
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && (multiplier > 1 || rnd) {
+		return nil, p.newParseError("%s with a multiplier can't be named", typ)
+	}
+	if err := p.slurpOpen(); err != nil {
+		return nil, err
+	}
+	children := []Entity{}
+	if ok, err := p.nextChar(')'); err != nil {
+		return nil, err
+	} else if !ok {
+		for {
+			entity, err := p.parseEntity()
+			if err != nil {
+				return nil, err
+			}
+			if typ == "list" && entity.GetName() != "" {
+				return nil, p.newParseError("list entries can't be named")
+			}
+			children = append(children, entity)
+			if comma, err := p.slurpComma(); err != nil {
+				return nil, err
+			} else if !comma {
+				break
+			}
+		}
+	}
+	if err := p.slurpClose(); err != nil {
+		return nil, err
+	}
+	if typ == "list" {
+		return List{
+			Codec:            codec,
+			Name:             name,
+			Multiplier:       multiplier,
+			RandomMultiplier: rnd,
+			Children:         children,
+		}, nil
+	}
+	return Map{
+		Codec:            codec,
+		Name:             name,
+		Multiplier:       multiplier,
+		RandomMultiplier: rnd,
+		Children:         children,
+	}, nil
+}
+
+func (p *parser) parseBytes(multiplier int, rnd bool) (Entity, error) {
+	// same form as a file, a human readable size and file options
+	size, rndSize, err := p.slurpSize()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := p.slurpFileOptions(false)
+	if err != nil {
+		return nil, err
+	}
+	if opts.name != "" && (multiplier > 1 || rnd) {
+		return nil, p.newParseError("bytes with a multiplier can't be named")
+	}
+	return Bytes{
+		Name:             opts.name,
+		Multiplier:       multiplier,
+		RandomMultiplier: rnd,
+		Size:             size,
+		RandomSize:       rndSize,
+		ZeroContent:      opts.zero,
+	}, nil
+}
+
+func (p *parser) parseScalar(typ string, multiplier int, rnd bool) (Entity, error) {
+	scalar := Scalar{
+		Kind:             datamodel.Kind_Null,
+		Multiplier:       multiplier,
+		RandomMultiplier: rnd,
+	}
+	if typ != "null" {
+		if ok, err := p.nextChar(':'); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, p.newParseError("expected ':'")
+		}
+		p.pos++
+		if !p.hasMore() {
+			return nil, p.newParseError("unexpected end")
+		}
+		switch typ {
+		case "int":
+			str := p.slurpNumber()
+			v, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return nil, p.newParseError("expected integer")
+			}
+			scalar.Kind, scalar.Value = datamodel.Kind_Int, v
+		case "float":
+			str := p.slurpNumber()
+			v, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, p.newParseError("expected float")
+			}
+			scalar.Kind, scalar.Value = datamodel.Kind_Float, v
+		case "string":
+			v, err := p.slurpQuotedString()
+			if err != nil {
+				return nil, err
+			}
+			scalar.Kind, scalar.Value = datamodel.Kind_String, v
+		case "bool":
+			var v bool
+			if strings.HasPrefix(p.str[p.pos:], "true") {
+				p.pos += 4
+				v = true
+			} else if strings.HasPrefix(p.str[p.pos:], "false") {
+				p.pos += 5
+			} else {
+				return nil, p.newParseError("expected 'true' or 'false'")
+			}
+			scalar.Kind, scalar.Value = datamodel.Kind_Bool, v
+		}
+	}
+	name, err := p.slurpScalarOptions()
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && (multiplier > 1 || rnd) {
+		return nil, p.newParseError("%s with a multiplier can't be named", typ)
+	}
+	scalar.Name = name
+	return scalar, nil
+}
+
+type fileOptions struct {
+	name      string
+	zero      bool
+	chunkSize uint64
+	fanout    int
+	layout    FileLayout
+	leaves    LeafType
+	inline    uint64
+}
+
 // slurpFileOptions looks for an optional {} block which may optionally contain
-// `zero` and `name:"foo"`, comma separated. Returns name adn zero.
-func (p *parser) slurpFileOptions() (name string, zero bool, err error) {
+// `zero` and `name:"foo"`, comma separated. If shape is true, the options that
+// control the shape of a file DAG are also allowed: `chunk:SIZE`, `fanout:N`,
+// `layout:balanced|trickle`, `leaves:raw|pb-file|pb-raw|mixed` and
+// `inline:SIZE`.
+func (p *parser) slurpFileOptions(shape bool) (opts fileOptions, err error) {
 	if !p.hasMore() {
-		return "", false, nil
+		return opts, nil
 	}
 	if ok, err := p.nextChar('{'); err != nil {
-		return "", false, err
+		return opts, err
 	} else if !ok {
-		return "", false, nil
+		return opts, nil
 	}
 	p.pos++
 	if !p.hasMore() {
-		return "", false, p.newParseError("unexpected end")
+		return opts, p.newParseError("unexpected end")
 	}
 	var vc int
 	for p.hasMore() {
 		if ok, err := p.nextChar('}'); err != nil {
-			return "", false, err
+			return opts, err
 		} else if ok {
 			p.pos++
 			break
 		}
 		if vc > 0 {
 			if ok, err := p.nextChar(','); err != nil {
-				return "", false, err
+				return opts, err
 			} else if !ok {
-				return "", false, p.newParseError("expected ','")
+				return opts, p.newParseError("expected ','")
 			}
 			p.pos++
 		}
 		if strings.HasPrefix(p.str[p.pos:], "zero") {
 			p.pos += 4
-			zero = true
+			opts.zero = true
 			vc++
 			continue
 		}
@@ -203,23 +414,111 @@ func (p *parser) slurpFileOptions() (name string, zero bool, err error) {
 		if strings.HasPrefix(p.str[p.pos:], "name") {
 			p.pos += 4
 			if ok, err := p.nextChar(':'); err != nil {
-				return "", false, err
+				return opts, err
+			} else if !ok {
+				return opts, p.newParseError("expected ':'")
+			}
+			p.pos++
+			if opts.name, err = p.slurpName(); err != nil {
+				return opts, err
+			}
+			vc++
+			continue
+		}
+		if !shape {
+			return opts, p.newParseError("expected 'zero' or 'name'")
+		}
+		if strings.HasPrefix(p.str[p.pos:], "chunk") {
+			p.pos += 5
+			var rnd bool
+			if opts.chunkSize, rnd, err = p.slurpSize(); err != nil {
+				return opts, err
+			} else if rnd || opts.chunkSize == 0 {
+				return opts, p.newParseError("expected fixed size > 0")
+			}
+			vc++
+			continue
+		}
+		if strings.HasPrefix(p.str[p.pos:], "fanout") {
+			p.pos += 6
+			if ok, err := p.nextChar(':'); err != nil {
+				return opts, err
 			} else if !ok {
-				return "", false, p.newParseError("expected ':'")
+				return opts, p.newParseError("expected ':'")
 			}
 			p.pos++
-			if name, err = p.slurpQuotedString(); err != nil {
-				return "", false, err
+			var ok bool
+			if opts.fanout, ok, err = p.slurpInteger(); err != nil {
+				return opts, err
+			} else if !ok {
+				return opts, p.newParseError("expected integer")
+			} else if opts.fanout <= 1 {
+				return opts, p.newParseError("expected integer > 1")
+			}
+			vc++
+			continue
+		}
+		if strings.HasPrefix(p.str[p.pos:], "layout:") {
+			p.pos += 7
+			layout, err := p.slurpOneOf(string(FileLayout_Balanced), string(FileLayout_Trickle))
+			if err != nil {
+				return opts, err
+			}
+			opts.layout = FileLayout(layout)
+			vc++
+			continue
+		}
+		if strings.HasPrefix(p.str[p.pos:], "leaves:") {
+			p.pos += 7
+			leaves, err := p.slurpOneOf(string(LeafType_Raw), string(LeafType_PbFile), string(LeafType_PbRaw), string(LeafType_Mixed))
+			if err != nil {
+				return opts, err
 			}
+			opts.leaves = LeafType(leaves)
 			vc++
 			continue
 		}
-		return "", false, p.newParseError("expected 'zero' or 'name'")
+		if strings.HasPrefix(p.str[p.pos:], "inline") {
+			p.pos += 6
+			var rnd bool
+			if opts.inline, rnd, err = p.slurpSize(); err != nil {
+				return opts, err
+			} else if rnd || opts.inline == 0 {
+				return opts, p.newParseError("expected fixed size > 0")
+			}
+			vc++
+			continue
+		}
+		return opts, p.newParseError("expected 'zero', 'name', 'chunk', 'fanout', 'layout', 'leaves' or 'inline'")
 	}
-	return name, zero, nil
+	return opts, nil
 }
 
-// slurpQuotedString looks for a quoted string, which is always required
+// slurpOneOf looks for one of the given words.
+func (p *parser) slurpOneOf(words ...string) (string, error) {
+	for _, word := range words {
+		if strings.HasPrefix(p.str[p.pos:], word) {
+			p.pos += len(word)
+			return word, nil
+		}
+	}
+	return "", p.newParseError("expected one of '%s'", strings.Join(words, "', '"))
+}
+
+// slurpName looks for a quoted, non-empty string, which is always required
+func (p *parser) slurpName() (string, error) {
+	name, err := p.slurpQuotedString()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", p.newParseError("expected name")
+	}
+	return name, nil
+}
+
+// slurpQuotedString looks for a quoted string, which is always required, but
+// may be empty
 func (p *parser) slurpQuotedString() (string, error) {
 	if !p.hasMore() {
 		return "", p.newParseError("unexpected end")
@@ -237,9 +536,6 @@ func (p *parser) slurpQuotedString() (string, error) {
 		}
 		iend++
 	}
-	if iend == p.pos {
-		return "", p.newParseError("expected name")
-	}
 	name := p.str[p.pos:iend]
 	p.pos = iend
 	if ok, err := p.nextChar('"'); err != nil {
@@ -312,7 +608,7 @@ func (p *parser) slurpDirOptions() (name string, shardBitwidth int, err error) {
 				return "", 0, p.newParseError("expected ':'")
 			}
 			p.pos++
-			if name, err = p.slurpQuotedString(); err != nil {
+			if name, err = p.slurpName(); err != nil {
 				return "", 0, err
 			}
 			vc++
@@ -323,6 +619,128 @@ func (p *parser) slurpDirOptions() (name string, shardBitwidth int, err error) {
 	return name, shardBitwidth, nil
 }
 
+// slurpNodeOptions looks for an optional {} block which may optionally contain
+// `name:"foo"`, or `codec:X` where X is `dag-cbor` or `dag-json`, comma
+// separated. Returns name and codec. If neither are supplied, the name is empty
+// and the codec is dag-cbor.
+func (p *parser) slurpNodeOptions() (name string, codec Codec, err error) {
+	codec = Codec_DagCbor
+	if !p.hasMore() {
+		return "", codec, nil
+	}
+	if ok, err := p.nextChar('{'); err != nil {
+		return "", "", err
+	} else if !ok {
+		return "", codec, nil
+	}
+	p.pos++
+	if !p.hasMore() {
+		return "", "", p.newParseError("unexpected end")
+	}
+	var vc int
+	for p.hasMore() {
+		if ok, err := p.nextChar('}'); err != nil {
+			return "", "", err
+		} else if ok {
+			p.pos++
+			break
+		}
+		if vc > 0 {
+			if ok, err := p.nextChar(','); err != nil {
+				return "", "", err
+			} else if !ok {
+				return "", "", p.newParseError("expected ','")
+			}
+			p.pos++
+		}
+		if strings.HasPrefix(p.str[p.pos:], "codec") {
+			p.pos += 5
+			if ok, err := p.nextChar(':'); err != nil {
+				return "", "", err
+			} else if !ok {
+				return "", "", p.newParseError("expected ':'")
+			}
+			p.pos++
+			if strings.HasPrefix(p.str[p.pos:], string(Codec_DagCbor)) {
+				p.pos += len(Codec_DagCbor)
+				codec = Codec_DagCbor
+			} else if strings.HasPrefix(p.str[p.pos:], string(Codec_DagJson)) {
+				p.pos += len(Codec_DagJson)
+				codec = Codec_DagJson
+			} else {
+				return "", "", p.newParseError("expected 'dag-cbor' or 'dag-json'")
+			}
+			vc++
+			continue
+		}
+		if strings.HasPrefix(p.str[p.pos:], "name") {
+			p.pos += 4
+			if ok, err := p.nextChar(':'); err != nil {
+				return "", "", err
+			} else if !ok {
+				return "", "", p.newParseError("expected ':'")
+			}
+			p.pos++
+			if name, err = p.slurpName(); err != nil {
+				return "", "", err
+			}
+			vc++
+			continue
+		}
+		return "", "", p.newParseError("expected 'codec' or 'name'")
+	}
+	return name, codec, nil
+}
+
+// slurpScalarOptions looks for an optional {} block which may only contain
+// `name:"foo"`. Returns name.
+func (p *parser) slurpScalarOptions() (name string, err error) {
+	if !p.hasMore() {
+		return "", nil
+	}
+	if ok, err := p.nextChar('{'); err != nil {
+		return "", err
+	} else if !ok {
+		return "", nil
+	}
+	p.pos++
+	if !strings.HasPrefix(p.str[p.pos:], "name") {
+		return "", p.newParseError("expected 'name'")
+	}
+	p.pos += 4
+	if ok, err := p.nextChar(':'); err != nil {
+		return "", err
+	} else if !ok {
+		return "", p.newParseError("expected ':'")
+	}
+	p.pos++
+	if name, err = p.slurpName(); err != nil {
+		return "", err
+	}
+	if ok, err := p.nextChar('}'); err != nil {
+		return "", err
+	} else if !ok {
+		return "", p.newParseError("expected '}'")
+	}
+	p.pos++
+	return name, nil
+}
+
+// slurpNumber collects the characters that may make up a signed integer or
+// float, the caller is responsible for parsing them
+func (p *parser) slurpNumber() string {
+	iend := p.pos
+	for _, r := range p.str[p.pos:] {
+		if !(unicode.IsDigit(r) || strings.ContainsRune("-+.eE", r)) {
+			break
+		}
+		iend++
+	}
+	str := p.str[p.pos:iend]
+	p.pos = iend
+	return str
+}
+
 // slurpInteger parses an integer, if one exists, return the integer and true
 // if one exists, false otherwise
 func (p *parser) slurpInteger() (int, bool, error) {
@@ -414,6 +832,17 @@ func (p *parser) slurpComma() (bool, error) {
 	return false, nil
 }
 
+// slurpSpace skips over any whitespace, and reports whether it included a
+// newline
+func (p *parser) slurpSpace() bool {
+	var newline bool
+	for p.hasMore() && unicode.IsSpace(rune(p.str[p.pos])) {
+		newline = newline || p.str[p.pos] == '\n'
+		p.pos++
+	}
+	return newline
+}
+
 // slurpOpen looks for a '(', which is strictly required
 func (p *parser) slurpOpen() error {
 	if ok, err := p.nextChar('('); err != nil {
@@ -467,19 +896,19 @@ func (p *parser) slurpMultiplier() (multiplier int, err error) {
 	return multiplier, nil
 }
 
-// slurpType looks for the strings "file" or "dir", which are strictly required
-// to be next, nothing else is allowed
+var entityTypes = []string{"file", "dir", "map", "list", "bytes", "int", "float", "string", "bool", "null"}
+
+// slurpType looks for one of the entityTypes strings, such as "file" or "dir",
+// which are strictly required to be next, nothing else is allowed
 func (p *parser) slurpType() (string, error) {
 	if !p.hasMore() {
 		return "", p.newParseError("unexpected end")
 	}
-	if strings.HasPrefix(p.str[p.pos:], "file") {
-		p.pos += 4
-		return "file", nil
-	}
-	if strings.HasPrefix(p.str[p.pos:], "dir") {
-		p.pos += 3
-		return "dir", nil
+	for _, typ := range entityTypes {
+		if strings.HasPrefix(p.str[p.pos:], typ) {
+			p.pos += len(typ)
+			return typ, nil
+		}
 	}
-	return "", p.newParseError("expected 'file' or 'dir'")
+	return "", p.newParseError("expected one of '%s'", strings.Join(entityTypes, "', '"))
 }
@@ -3,6 +3,7 @@ package generator
 import (
 	"testing"
 
+	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/test-go/testify/require"
 )
 
@@ -216,6 +217,92 @@ func TestParsing(t *testing.T) {
 			},
 			explained: "A directory containing:\n  → Approximately 5 files of 1.0 kB\n  → Approximately 5 files of approximately 102 kB\n  → 2 directories sharded with bitwidth 4 containing:\n    → Approximately 10 files of 51 kB\n  → A file of 1.0 MB containing just zeros\n  → A file of 10 B\n  → A file of 20 B",
 		},
+		{
+			input: `map(file:1K{name:"foo"},int:-5{name:"bar"},string:"baz",2*bool:true,null,bytes:10B{zero})`,
+			expected: Map{Multiplier: 1, Codec: Codec_DagCbor, Children: []Entity{
+				File{Multiplier: 1, Size: 1000, Name: "foo"},
+				Scalar{Multiplier: 1, Kind: datamodel.Kind_Int, Value: int64(-5), Name: "bar"},
+				Scalar{Multiplier: 1, Kind: datamodel.Kind_String, Value: "baz"},
+				Scalar{Multiplier: 2, Kind: datamodel.Kind_Bool, Value: true},
+				Scalar{Multiplier: 1, Kind: datamodel.Kind_Null},
+				Bytes{Multiplier: 1, Size: 10, ZeroContent: true},
+			}},
+			explained: "A dag-cbor map containing:\n  → A file named \"foo\" of 1.0 kB\n  → An int named \"bar\" with value -5\n  → A string with value \"baz\"\n  → 2 bools with value true\n  → A null\n  → A bytes value of 10 B containing just zeros",
+		},
+		{
+			input: `list{codec:dag-json}(float:1.5,~3*map(),dir(file:1K),list())`,
+			expected: List{Multiplier: 1, Codec: Codec_DagJson, Children: []Entity{
+				Scalar{Multiplier: 1, Kind: datamodel.Kind_Float, Value: 1.5},
+				Map{Multiplier: 3, RandomMultiplier: true, Codec: Codec_DagCbor, Children: []Entity{}},
+				Directory{Multiplier: 1, Type: DirType_Plain, Children: []Entity{File{Multiplier: 1, Size: 1000}}},
+				List{Multiplier: 1, Codec: Codec_DagCbor, Children: []Entity{}},
+			}},
+			explained: "A dag-json list containing:\n  → A float with value 1.5\n  → Approximately 3 dag-cbor maps containing:\n  → A directory containing:\n    → A file of 1.0 kB\n  → A dag-cbor list containing:",
+		},
+		{
+			input: `map(map{name:"a",codec:dag-json}(string:""{name:"b"}))`,
+			expected: Map{Multiplier: 1, Codec: Codec_DagCbor, Children: []Entity{
+				Map{Multiplier: 1, Codec: Codec_DagJson, Name: "a", Children: []Entity{
+					Scalar{Multiplier: 1, Kind: datamodel.Kind_String, Value: "", Name: "b"},
+				}},
+			}},
+			explained: "A dag-cbor map containing:\n  → A dag-json map named \"a\" containing:\n    → A string named \"b\" with value \"\"",
+		},
+		{
+			input: `list(int:1{name:"a"})`,
+			err:   "list entries can't be named",
+		},
+		{
+			input: `map(2*int:1{name:"a"})`,
+			err:   "int with a multiplier can't be named",
+		},
+		{
+			input: `dir(map(int:1))`,
+			err:   "directory can only contain files and directories",
+		},
+		{
+			input: `int:1`,
+			err:   "root entity must be a file, dir, map or list",
+		},
+		{
+			input: `map{codec:dag-pb}()`,
+			err:   "expected 'dag-cbor' or 'dag-json'",
+		},
+		{
+			input: `map(bool:yes)`,
+			err:   "expected 'true' or 'false'",
+		},
+		{
+			input:     `file:1MB{chunk:1kB,fanout:8,layout:trickle,leaves:mixed}`,
+			expected:  File{Multiplier: 1, Size: 1000000, ChunkSize: 1000, Fanout: 8, Layout: FileLayout_Trickle, Leaves: LeafType_Mixed},
+			explained: "A file of 1.0 MB in chunks of 1.0 kB with a fanout of 8 in a trickle layout with mixed leaves",
+		},
+		{
+			input:     `dir(file:10kB{zero,leaves:pb-raw,name:"a"})`,
+			expected:  Directory{Multiplier: 1, Type: DirType_Plain, Children: []Entity{File{Multiplier: 1, Size: 10000, ZeroContent: true, Leaves: LeafType_PbRaw, Name: "a"}}},
+			explained: "A directory containing:\n  → A file named \"a\" of 10 kB containing just zeros with dag-pb Raw leaves",
+		},
+		{
+			input:     `file:10kB{chunk:1kB,fanout:2,inline:100B}`,
+			expected:  File{Multiplier: 1, Size: 10000, ChunkSize: 1000, Fanout: 2, InlineSize: 100},
+			explained: "A file of 10 kB in chunks of 1.0 kB with a fanout of 2 and 100 B of data in each intermediate node",
+		},
+		{
+			input: `file:1MB{layout:sideways}`,
+			err:   "expected one of 'balanced', 'trickle'",
+		},
+		{
+			input: `file:1MB{fanout:1}`,
+			err:   "expected integer > 1",
+		},
+		{
+			input: `file:1MB{chunk:~1kB}`,
+			err:   "expected fixed size > 0",
+		},
+		{
+			input: `map(bytes:1kB{chunk:1kB})`,
+			err:   "expected 'zero' or 'name'",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -234,3 +321,67 @@ func TestParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRoots(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []Entity
+		err      string
+	}{
+		{
+			name:     "single",
+			input:    `file:1kB`,
+			expected: []Entity{File{Multiplier: 1, Size: 1000}},
+		},
+		{
+			name:  "commas",
+			input: `file:1kB,dir(file:2kB)`,
+			expected: []Entity{
+				File{Multiplier: 1, Size: 1000},
+				Directory{Multiplier: 1, Type: DirType_Plain, Children: []Entity{File{Multiplier: 1, Size: 2000}}},
+			},
+		},
+		{
+			name:  "lines",
+			input: "\n  file:1kB\n\tdir(file:2kB),\n\nfile:3kB\n",
+			expected: []Entity{
+				File{Multiplier: 1, Size: 1000},
+				Directory{Multiplier: 1, Type: DirType_Plain, Children: []Entity{File{Multiplier: 1, Size: 2000}}},
+				File{Multiplier: 1, Size: 3000},
+			},
+		},
+		{
+			name:  "no separator",
+			input: `dir(file:2kB) file:1kB`,
+			err:   "parse error at position 14: expected ',' or newline between root entities",
+		},
+		{
+			name:  "multiplier",
+			input: "file:1kB\n2*file:1kB",
+			err:   "parse error at position 9: root entity must be strictly signular",
+		},
+		{
+			name:  "named",
+			input: `file:1kB,file:1kB{name:"a"}`,
+			err:   "parse error at position 9: root entity can't be named",
+		},
+		{
+			name:  "empty",
+			input: " \n ",
+			err:   "no root entities",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseRoots(tc.input)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
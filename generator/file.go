@@ -0,0 +1,323 @@
+package generator
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	unixfstestutil "github.com/ipfs/go-unixfsnode/testutil"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+)
+
+// FileLayout is the shape of the DAG a file's chunks are arranged in.
+type FileLayout string
+
+const (
+	FileLayout_Balanced FileLayout = "balanced"
+	FileLayout_Trickle  FileLayout = "trickle"
+)
+
+// LeafType is the encoding of the leaf (chunk) blocks of a file.
+type LeafType string
+
+const (
+	LeafType_Raw    LeafType = "raw"     // raw codec blocks
+	LeafType_PbFile LeafType = "pb-file" // dag-pb UnixFS File nodes
+	LeafType_PbRaw  LeafType = "pb-raw"  // dag-pb UnixFS Raw nodes
+	LeafType_Mixed  LeafType = "mixed"   // each of the above, in turn
+)
+
+const (
+	defaultChunkSize = 256144 // as used by go-unixfsnode/testutil
+	trickleRepeat    = 4      // as used by the go-unixfs trickle importer
+)
+
+var mixedLeafTypes = []LeafType{LeafType_Raw, LeafType_PbFile, LeafType_PbRaw}
+
+// fileBuilder builds a UnixFS file DAG from a stream of bytes, with control
+// over the chunk size, fanout, layout and leaf encoding that the go-unixfsnode
+// builder doesn't offer.
+type fileBuilder struct {
+	lsys      linking.LinkSystem
+	chunkSize int
+	fanout    int
+	layout    FileLayout
+	leaves    LeafType
+	inline    int
+
+	r        io.Reader
+	next     []byte
+	err      error
+	leafIdx  int
+	selfCids []cid.Cid
+}
+
+// fileShard is a stored block of a file and the number of bytes of the file
+// under it, along with that content in order.
+type fileShard struct {
+	cid      cid.Cid
+	byteSize uint64
+	tsize    uint64
+	content  [][]byte
+}
+
+func (f File) buildFile(lsys linking.LinkSystem, r io.Reader) (unixfstestutil.DirEntry, error) {
+	fb := &fileBuilder{
+		lsys:      lsys,
+		chunkSize: int(f.ChunkSize),
+		fanout:    f.Fanout,
+		layout:    f.Layout,
+		leaves:    f.Leaves,
+		inline:    int(f.InlineSize),
+	}
+	if fb.chunkSize <= 0 {
+		fb.chunkSize = defaultChunkSize
+	}
+	if fb.fanout <= 1 {
+		fb.fanout = builder.DefaultLinksPerBlock
+	}
+	if fb.layout == "" {
+		fb.layout = FileLayout_Balanced
+	}
+	if fb.leaves == "" {
+		fb.leaves = LeafType_Raw
+	}
+
+	fb.r = r
+
+	var root fileShard
+	var err error
+	if fb.layout == FileLayout_Trickle {
+		root, err = fb.trickle(-1)
+	} else {
+		root, err = fb.balanced()
+	}
+	if err != nil {
+		return unixfstestutil.DirEntry{}, err
+	}
+	// the content is assembled in DAG order, as inline data in intermediate
+	// nodes may be read from the source after the content below it
+	return unixfstestutil.DirEntry{
+		Content:  bytes.Join(root.content, nil),
+		Root:     root.cid,
+		SelfCids: fb.selfCids,
+		TSize:    root.tsize,
+	}, nil
+}
+
+// done reports whether all the bytes have been consumed.
+func (fb *fileBuilder) done() bool {
+	if fb.next == nil && fb.err == nil {
+		fb.next = make([]byte, fb.chunkSize)
+		n, err := io.ReadFull(fb.r, fb.next)
+		fb.next = fb.next[:n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		fb.err = err
+	}
+	return len(fb.next) == 0 && fb.err != nil
+}
+
+func (fb *fileBuilder) leaf() (fileShard, error) {
+	fb.done()
+	if fb.err != nil && fb.err != io.EOF {
+		return fileShard{}, fb.err
+	}
+	chunk := fb.next
+	fb.next = nil
+
+	leafType := fb.leaves
+	if leafType == LeafType_Mixed {
+		leafType = mixedLeafTypes[fb.leafIdx%len(mixedLeafTypes)]
+	}
+	fb.leafIdx++
+
+	if leafType == LeafType_Raw {
+		return fb.store(cid.Raw, basicnode.NewBytes(chunk), chunk, nil)
+	}
+	dt := data.Data_File
+	if leafType == LeafType_PbRaw {
+		dt = data.Data_Raw
+	}
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.DataType(b, dt)
+		builder.FileSize(b, uint64(len(chunk)))
+		builder.Data(b, chunk)
+	})
+	if err != nil {
+		return fileShard{}, err
+	}
+	node, err := packFile(ufsData, nil)
+	if err != nil {
+		return fileShard{}, err
+	}
+	return fb.store(cid.DagProtobuf, node, chunk, nil)
+}
+
+// inlineData reads the data to be held by an intermediate node, up to the
+// configured inline size and as long as there is content remaining. This is
+// read when the node is started, so that it isn't starved by its children.
+func (fb *fileBuilder) inlineData() ([]byte, error) {
+	if fb.inline == 0 {
+		return nil, nil
+	}
+	byt := make([]byte, fb.inline)
+	n, err := io.ReadFull(fb.r, byt)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return byt[:n], nil
+}
+
+// node stores a File node holding inline data, if any, and linking to the
+// given children.
+func (fb *fileBuilder) node(inline []byte, children []fileShard) (fileShard, error) {
+	fileSize := uint64(len(inline))
+	blockSizes := make([]uint64, len(children))
+	for ii, child := range children {
+		fileSize += child.byteSize
+		blockSizes[ii] = child.byteSize
+	}
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.FileSize(b, fileSize)
+		builder.BlockSizes(b, blockSizes)
+		if len(inline) > 0 {
+			builder.Data(b, inline)
+		}
+	})
+	if err != nil {
+		return fileShard{}, err
+	}
+	node, err := packFile(ufsData, children)
+	if err != nil {
+		return fileShard{}, err
+	}
+	return fb.store(cid.DagProtobuf, node, inline, children)
+}
+
+// store stores a block of the file, which holds the given data and links to
+// the given children.
+func (fb *fileBuilder) store(codec uint64, node datamodel.Node, byt []byte, children []fileShard) (fileShard, error) {
+	c, tsize, err := storeBlock(fb.lsys, codec, node)
+	if err != nil {
+		return fileShard{}, err
+	}
+	fb.selfCids = append(fb.selfCids, c)
+	shard := fileShard{cid: c, byteSize: uint64(len(byt)), content: [][]byte{byt}}
+	for _, child := range children {
+		shard.byteSize += child.byteSize
+		shard.content = append(shard.content, child.content...)
+		tsize += child.tsize
+	}
+	shard.tsize = tsize
+	return shard, nil
+}
+
+// balanced lays out the file as the go-unixfs balanced importer does: leaves
+// are filled left to right, and the tree grows a new root, with the previous
+// root as its first child, each time it fills.
+func (fb *fileBuilder) balanced() (fileShard, error) {
+	root, err := fb.leaf()
+	if err != nil {
+		return fileShard{}, err
+	}
+	for depth := 1; !fb.done(); depth++ {
+		inline, err := fb.inlineData()
+		if err != nil {
+			return fileShard{}, err
+		}
+		children := []fileShard{root}
+		if children, err = fb.fillBalanced(children, depth); err != nil {
+			return fileShard{}, err
+		}
+		if root, err = fb.node(inline, children); err != nil {
+			return fileShard{}, err
+		}
+	}
+	return root, nil
+}
+
+func (fb *fileBuilder) fillBalanced(children []fileShard, depth int) ([]fileShard, error) {
+	for len(children) < fb.fanout && !fb.done() {
+		var child fileShard
+		var err error
+		if depth == 1 {
+			child, err = fb.leaf()
+		} else {
+			var inline []byte
+			var grandchildren []fileShard
+			if inline, err = fb.inlineData(); err == nil {
+				if grandchildren, err = fb.fillBalanced(nil, depth-1); err == nil {
+					child, err = fb.node(inline, grandchildren)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// trickle lays out the file as the go-unixfs trickle importer does: each node
+// holds up to fanout leaves followed by trickleRepeat subtrees of each
+// increasing depth, up to maxDepth (unlimited for the root).
+func (fb *fileBuilder) trickle(maxDepth int) (fileShard, error) {
+	inline, err := fb.inlineData()
+	if err != nil {
+		return fileShard{}, err
+	}
+	children := make([]fileShard, 0)
+	for len(children) < fb.fanout && !fb.done() {
+		child, err := fb.leaf()
+		if err != nil {
+			return fileShard{}, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 0 && len(inline) == 0 { // empty file
+		child, err := fb.leaf()
+		if err != nil {
+			return fileShard{}, err
+		}
+		children = append(children, child)
+	}
+	for depth := 1; (maxDepth == -1 || depth < maxDepth) && !fb.done(); depth++ {
+		for ii := 0; ii < trickleRepeat && !fb.done(); ii++ {
+			child, err := fb.trickle(depth)
+			if err != nil {
+				return fileShard{}, err
+			}
+			children = append(children, child)
+		}
+	}
+	return fb.node(inline, children)
+}
+
+// packFile builds a dag-pb node with the UnixFS data and unnamed links to the
+// children.
+func packFile(ufsData data.UnixFSData, children []fileShard) (datamodel.Node, error) {
+	return qp.BuildMap(dagpb.Type.PBNode, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Links", qp.List(int64(len(children)), func(la datamodel.ListAssembler) {
+			for _, child := range children {
+				pbl, err := builder.BuildUnixFSDirectoryEntry("", int64(child.tsize), cidlink.Link{Cid: child.cid})
+				if err != nil {
+					panic(err) // caught by qp
+				}
+				qp.ListEntry(la, qp.Node(pbl))
+			}
+		}))
+		qp.MapEntry(ma, "Data", qp.Bytes(data.EncodeUnixFSData(ufsData)))
+	})
+}
@@ -34,6 +34,17 @@ type File struct {
 	ZeroContent      bool
 	Multiplier       int
 	RandomMultiplier bool
+	ChunkSize        uint64     // defaults to 256,144 bytes
+	Fanout           int        // maximum links per node, defaults to 174
+	Layout           FileLayout // defaults to FileLayout_Balanced
+	Leaves           LeafType   // defaults to LeafType_Raw
+	InlineSize       uint64     // bytes of content held in each intermediate node
+}
+
+// customised returns true if any of the options that control the shape of the
+// file DAG are set.
+func (f File) customised() bool {
+	return f.ChunkSize != 0 || f.Fanout != 0 || f.Layout != "" || f.Leaves != "" || f.InlineSize != 0
 }
 
 func (f File) GetName() string {
@@ -61,8 +72,27 @@ func (f File) String() string {
 		sb.WriteRune('~')
 	}
 	sb.WriteString(strings.ReplaceAll(humanize.Bytes(uint64(f.Size)), " ", ""))
+	opts := make([]string, 0)
 	if f.ZeroContent {
-		sb.WriteString("{zero}")
+		opts = append(opts, "zero")
+	}
+	if f.ChunkSize != 0 {
+		opts = append(opts, "chunk:"+strings.ReplaceAll(humanize.Bytes(f.ChunkSize), " ", ""))
+	}
+	if f.Fanout != 0 {
+		opts = append(opts, fmt.Sprintf("fanout:%d", f.Fanout))
+	}
+	if f.Layout != "" {
+		opts = append(opts, "layout:"+string(f.Layout))
+	}
+	if f.Leaves != "" {
+		opts = append(opts, "leaves:"+string(f.Leaves))
+	}
+	if f.InlineSize != 0 {
+		opts = append(opts, "inline:"+strings.ReplaceAll(humanize.Bytes(f.InlineSize), " ", ""))
+	}
+	if len(opts) > 0 {
+		sb.WriteString("{" + strings.Join(opts, ",") + "}")
 	}
 	return sb.String()
 }
@@ -104,6 +134,31 @@ func (f File) Describe(indent string) string {
 	if f.ZeroContent {
 		sb.WriteString(" containing just zeros")
 	}
+	if f.ChunkSize != 0 {
+		sb.WriteString(" in chunks of ")
+		sb.WriteString(humanize.Bytes(f.ChunkSize))
+	}
+	if f.Fanout != 0 {
+		sb.WriteString(fmt.Sprintf(" with a fanout of %d", f.Fanout))
+	}
+	if f.Layout != "" {
+		sb.WriteString(fmt.Sprintf(" in a %s layout", f.Layout))
+	}
+	switch f.Leaves {
+	case LeafType_Raw:
+		sb.WriteString(" with raw leaves")
+	case LeafType_PbFile:
+		sb.WriteString(" with dag-pb File leaves")
+	case LeafType_PbRaw:
+		sb.WriteString(" with dag-pb Raw leaves")
+	case LeafType_Mixed:
+		sb.WriteString(" with mixed leaves")
+	}
+	if f.InlineSize != 0 {
+		sb.WriteString(" and ")
+		sb.WriteString(humanize.Bytes(f.InlineSize))
+		sb.WriteString(" of data in each intermediate node")
+	}
 	return sb.String()
 }
 
@@ -123,6 +178,9 @@ func (f File) Generate(lsys linking.LinkSystem, rndReader io.Reader) (unixfstest
 			}
 		}
 	}
+	if f.customised() {
+		return f.buildFile(lsys, io.LimitReader(rndReader, int64(targetFileSize)))
+	}
 	return unixfstestutil.UnixFSFile(lsys, targetFileSize, unixfstestutil.WithRandReader(rndReader))
 }
 
@@ -224,21 +282,7 @@ func (d Directory) generate(parentName string, lsys linking.LinkSystem, rndReade
 	if d.Type == DirType_Sharded {
 		sbw = d.ShardBitwidth
 	}
-	children := make([]Entity, 0)
-	for _, child := range d.Children {
-		multiplier := child.GetMultiplier()
-		if child.IsRandomMultiplier() {
-			for {
-				multiplier = randNormInt(rndReader, multiplier)
-				if multiplier >= 0 { // could be zero!
-					break
-				}
-			}
-		}
-		for i := 0; i < multiplier; i++ {
-			children = append(children, child)
-		}
-	}
+	children := expandChildren(d.Children, rndReader)
 	chidx := 0
 	return unixfstestutil.UnixFSDirectory(
 		lsys,
@@ -267,12 +311,35 @@ func (d Directory) generate(parentName string, lsys linking.LinkSystem, rndReade
 				if de, err = et.generate(chname, lsys, rndReader); err != nil {
 					return nil, err
 				}
+			default:
+				return nil, fmt.Errorf("unsupported directory entry: %s", ch.String())
 			}
 			de.Path = chname
 			return &de, nil
 		}))
 }
 
+// expandChildren applies the multipliers of each of the children, returning
+// a flat list with each child repeated the appropriate number of times.
+func expandChildren(entities []Entity, rndReader io.Reader) []Entity {
+	children := make([]Entity, 0)
+	for _, child := range entities {
+		multiplier := child.GetMultiplier()
+		if child.IsRandomMultiplier() {
+			for {
+				multiplier = randNormInt(rndReader, multiplier)
+				if multiplier >= 0 { // could be zero!
+					break
+				}
+			}
+		}
+		for i := 0; i < multiplier; i++ {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
 func randNormInt(r io.Reader, mean int) int {
 	rnd := rand.New(rrandSource{r})
 	return int(rnd.NormFloat64()*float64(mean)/10.0 + float64(mean))